@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parseAccessLogSampling parses comma-separated endpoint=N pairs, each
+// logging one request in N to that endpoint.
+func parseAccessLogSampling(v string) (map[string]int, error) {
+	rates := make(map[string]int)
+	for _, pair := range splitList(v) {
+		endpoint, raw, ok := strings.Cut(pair, "=")
+		endpoint = strings.TrimSpace(endpoint)
+		if !ok || endpoint == "" {
+			return nil, fmt.Errorf("invalid access log sampling %q: must be endpoint=N", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid access log sampling %q: N must be a positive integer", pair)
+		}
+		rates[endpoint] = n
+	}
+	return rates, nil
+}
+
+// formatAccessLogSampling renders rates in the endpoint=N form
+// parseAccessLogSampling accepts, sorted by endpoint.
+func formatAccessLogSampling(rates map[string]int) string {
+	pairs := make([]string, 0, len(rates))
+	for endpoint, n := range rates {
+		pairs = append(pairs, endpoint+"="+strconv.Itoa(n))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// accessLogSampler picks which requests are access logged: none to the
+// endpoints in Config.AccessLogDisabledEndpoints, the first of every N to
+// those in Config.AccessLogSampling and all others.
+type accessLogSampler struct {
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// sample reports whether the current request to endpoint is logged.
+func (s *accessLogSampler) sample(cfg *Config, endpoint string) bool {
+	if !cfg.accessLogEnabled(endpoint) {
+		return false
+	}
+	n, ok := cfg.AccessLogSampling[endpoint]
+	if !ok || n <= 1 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]int)
+	}
+	i := s.seen[endpoint]
+	s.seen[endpoint] = (i + 1) % n
+	return i == 0
+}
+
+// accessRecord is what withTelemetry measured about a request, handed to
+// logAccess so the access log line matches the request's span and metrics.
+type accessRecord struct {
+	endpoint    string
+	status      int
+	duration    float64
+	spanContext trace.SpanContext
+}
+
+type accessRecordKey struct{}
+
+// recordAccess stores rec in the accessRecord logAccess put in ctx, if any.
+func recordAccess(ctx context.Context, rec accessRecord) {
+	if p, ok := ctx.Value(accessRecordKey{}).(*accessRecord); ok {
+		*p = rec
+	}
+}
+
+// logAccess writes an access log line for the requests to next that
+// a.accessLog picks, whatever answers them: routes, 404s, the 405 and
+// OPTIONS answers from allowMethods and recovered panics alike. Requests
+// served through withTelemetry are reported with its endpoint, status and
+// duration and correlated with its span; others with their path as the
+// endpoint and the status written.
+func (a *App) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		record := &accessRecord{}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessRecordKey{}, record)))
+		if record.endpoint == "" {
+			*record = accessRecord{
+				endpoint: r.URL.Path,
+				status:   rec.Status(),
+				duration: time.Since(start).Seconds(),
+			}
+		}
+
+		if !a.accessLog.sample(appConfig, record.endpoint) {
+			return
+		}
+		ctx := trace.ContextWithSpanContext(r.Context(), record.spanContext)
+		slog.InfoContext(ctx, "Request served",
+			"method", r.Method,
+			"endpoint", record.endpoint,
+			"path", r.URL.Path,
+			"status", record.status,
+			"duration_seconds", record.duration,
+		)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogSampling(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	rates, err := parseAccessLogSampling("/health=10")
+	if err != nil {
+		t.Fatalf("Failed to parse access log sampling: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.AccessLogSampling = rates })
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	tests := []struct {
+		endpoint string
+		requests int
+		want     int
+	}{
+		{endpoint: "/health", requests: 1000, want: 100},
+		{endpoint: "/metrics", requests: 20, want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			logs.Reset()
+			h := app.logAccess(app.withTelemetry(tt.endpoint, "request", func(w http.ResponseWriter, r *http.Request) {}))
+			for i := 0; i < tt.requests; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.endpoint, nil))
+			}
+			if got := strings.Count(logs.String(), `msg="Request served"`); got != tt.want {
+				t.Errorf("Expected %d of %d requests access logged, got %d", tt.want, tt.requests, got)
+			}
+		})
+	}
+}
+
+func TestParseAccessLogSamplingInvalid(t *testing.T) {
+	for _, v := range []string{"/health", "=10", "/health=0", "/health=ten"} {
+		if _, err := parseAccessLogSampling(v); err == nil {
+			t.Errorf("Expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestAccessLogEveryRoute(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	routes, err := parseRouteMethods("/work=GET")
+	if err != nil {
+		t.Fatalf("Failed to parse route methods: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.RouteMethods = routes })
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	// Neither /ready nor /debug/boom is served through withTelemetry
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", readyHandler)
+	mux.HandleFunc("/debug/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map write")
+	})
+	mux.HandleFunc("/work", app.withTelemetry("/work", "do_work", func(w http.ResponseWriter, r *http.Request) {}))
+	handler := app.serverHandler(appConfig, mux)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "plain route", method: http.MethodGet, path: "/ready", wantStatus: http.StatusServiceUnavailable},
+		{name: "recovered panic", method: http.MethodGet, path: "/debug/boom", wantStatus: http.StatusInternalServerError},
+		{name: "method not allowed", method: http.MethodDelete, path: "/work", wantStatus: http.StatusMethodNotAllowed},
+		{name: "options", method: http.MethodOptions, path: "/work", wantStatus: http.StatusNoContent},
+		{name: "unknown route", method: http.MethodGet, path: "/missing", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			var line struct {
+				Msg    string `json:"msg"`
+				Method string `json:"method"`
+				Path   string `json:"path"`
+				Status int    `json:"status"`
+			}
+			for _, raw := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+				if err := json.Unmarshal(raw, &line); err == nil && line.Msg == "Request served" {
+					break
+				}
+			}
+			if line.Msg != "Request served" || line.Method != tt.method || line.Path != tt.path || line.Status != tt.wantStatus {
+				t.Errorf("Expected an access log for %s %s with status %d, got %+v", tt.method, tt.path, tt.wantStatus, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxMemSpikeHold bounds how long /admin/memspike may hold its allocation.
+const maxMemSpikeHold = time.Minute
+
+// memSpikeBytes is the memory currently held by /admin/memspike requests.
+var memSpikeBytes atomic.Int64
+
+// reserveMemSpike adds size to memSpikeBytes unless that would take the
+// total held above limit, reporting whether the reservation was made.
+func reserveMemSpike(size, limit int64) bool {
+	for {
+		held := memSpikeBytes.Load()
+		if held+size > limit {
+			return false
+		}
+		if memSpikeBytes.CompareAndSwap(held, held+size) {
+			return true
+		}
+	}
+}
+
+// requireAdmin rejects requests that do not carry the configured admin token
+// as a bearer token. Admin endpoints are disabled when no token is set.
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := appConfig.AdminToken
+		if token == "" {
+			http.Error(w, "admin endpoints are disabled", http.StatusNotFound)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// memSpikeHandler allocates ?mb=N megabytes and holds them for ?hold_ms=T
+// milliseconds so operators can exercise memory limits and OOM handling.
+// Config.MaxMemSpikeMB bounds both a single request and the total held by
+// concurrent ones; requests that would exceed it get 429 Too Many Requests.
+func (a *App) memSpikeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	mb, err := strconv.Atoi(r.URL.Query().Get("mb"))
+	if err != nil || mb < 1 || mb > appConfig.MaxMemSpikeMB {
+		http.Error(w, fmt.Sprintf("mb must be an integer between 1 and %d", appConfig.MaxMemSpikeMB), http.StatusBadRequest)
+		return
+	}
+	hold := time.Duration(0)
+	if raw := r.URL.Query().Get("hold_ms"); raw != "" {
+		// Bound ms before converting, so a huge value cannot wrap around
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms < 0 || ms > maxMemSpikeHold.Milliseconds() {
+			http.Error(w, fmt.Sprintf("hold_ms must be an integer between 0 and %d", maxMemSpikeHold.Milliseconds()), http.StatusBadRequest)
+			return
+		}
+		hold = time.Duration(ms) * time.Millisecond
+	}
+
+	span.SetAttributes(
+		attribute.Int("memspike.mb", mb),
+		attribute.Int64("memspike.hold_ms", hold.Milliseconds()),
+	)
+
+	size := int64(mb) << 20
+	if !reserveMemSpike(size, int64(appConfig.MaxMemSpikeMB)<<20) {
+		http.Error(w, fmt.Sprintf("memory spikes in progress already hold %d of %d MB", memSpikeBytes.Load()>>20, appConfig.MaxMemSpikeMB), http.StatusTooManyRequests)
+		return
+	}
+	slog.InfoContext(ctx, "Memory spike: allocating", "mb", mb, "hold", hold)
+
+	buf := make([]byte, size)
+	// Touch every page so the allocation is actually resident
+	for i := 0; i < len(buf); i += 4096 {
+		buf[i] = 1
+	}
+	span.AddEvent("memory allocated")
+
+	sleepContext(ctx, hold)
+
+	runtime.KeepAlive(buf)
+	buf = nil
+	memSpikeBytes.Add(-size)
+	debug.FreeOSMemory()
+	span.AddEvent("memory released")
+	slog.InfoContext(ctx, "Memory spike: released", "mb", mb)
+
+	fmt.Fprintf(w, "Allocated and released %d MB after %s", mb, hold)
+}
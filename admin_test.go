@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestMemSpikeHandler(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "s3cret"
+		c.MaxMemSpikeMB = 4
+	})
+
+	tests := []struct {
+		name           string
+		target         string
+		token          string
+		expectedStatus int
+	}{
+		{
+			name:           "tiny allocation",
+			target:         "/admin/memspike?mb=1&hold_ms=10",
+			token:          "s3cret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "above the bound",
+			target:         "/admin/memspike?mb=5",
+			token:          "s3cret",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			// Multiplied by a millisecond this wraps to under a millisecond
+			name:           "hold overflows a duration",
+			target:         "/admin/memspike?mb=1&hold_ms=18446744073710",
+			token:          "s3cret",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong token",
+			target:         "/admin/memspike?mb=1",
+			token:          "guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			app.serveMemSpike(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if held := memSpikeBytes.Load(); held != 0 {
+				t.Errorf("Expected memory to be released after the hold, %d bytes still held", held)
+			}
+
+			if w.Code == http.StatusOK {
+				if mb, _ := spanAttribute(endedSpan(t, "memspike"), "memspike.mb"); mb.AsInt64() != 1 {
+					t.Errorf("Expected memspike.mb=1 on span, got %d", mb.AsInt64())
+				}
+			}
+		})
+	}
+}
+
+func TestMemSpikeHandlerTotalBound(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "s3cret"
+		c.MaxMemSpikeMB = 4
+	})
+
+	// Another spike already holds 3 of the 4 MB
+	if !reserveMemSpike(3<<20, 4<<20) {
+		t.Fatal("Failed to reserve the held memory")
+	}
+	t.Cleanup(func() { memSpikeBytes.Add(-3 << 20) })
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/memspike?mb=2", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	app.serveMemSpike(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusTooManyRequests, w.Code, w.Body.String())
+	}
+	if held := memSpikeBytes.Load(); held != 3<<20 {
+		t.Errorf("Expected the rejected spike to reserve nothing, %d bytes held", held)
+	}
+	if got := counterValue(t, collectMetrics(t), "http_requests_total", attribute.String("endpoint", "/admin/memspike"), attribute.String("status", "429")); got != 1 {
+		t.Errorf("Expected the rejected spike counted with status 429, got %d", got)
+	}
+}
+
+func TestRequireAdminDisabledWithoutToken(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AdminToken = "" })
+	app := &App{}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/memspike?mb=1", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+
+	requireAdmin(app.memSpikeHandler)(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
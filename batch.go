@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBatchItems bounds the ?items= a single /batch request may ask for.
+const maxBatchItems = 100
+
+// batchResult reports how much of a batch completed before its deadline.
+type batchResult struct {
+	Requested int  `json:"requested"`
+	Completed int  `json:"completed"`
+	Cancelled int  `json:"cancelled"`
+	Partial   bool `json:"partial"`
+}
+
+// batchHandler runs ?items=N simulated work items one after another under a
+// single Config.BatchDeadline. Items still pending when the deadline passes
+// are cancelled, and the response reports the partial completion. It is
+// served through withTelemetry.
+func (a *App) batchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	items, err := strconv.Atoi(r.URL.Query().Get("items"))
+	if err != nil || items < 1 || items > maxBatchItems {
+		span.SetAttributes(attribute.Bool("error", true))
+		http.Error(w, fmt.Sprintf("invalid items %q: must be an integer between 1 and %d", r.URL.Query().Get("items"), maxBatchItems), http.StatusBadRequest)
+		return
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, appConfig.BatchDeadline)
+	defer cancel()
+
+	res := batchResult{Requested: items}
+	for i := 0; i < items && batchCtx.Err() == nil; i++ {
+		if err := a.runBatchItem(batchCtx, i); err != nil {
+			break
+		}
+		res.Completed++
+	}
+	res.Cancelled = res.Requested - res.Completed
+	res.Partial = res.Cancelled > 0
+
+	span.SetAttributes(
+		attribute.Int("batch.items", res.Requested),
+		attribute.Int("batch.completed", res.Completed),
+		attribute.Int("batch.cancelled", res.Cancelled),
+	)
+	if res.Partial {
+		span.SetAttributes(attribute.Bool("batch.partial", true))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// runBatchItem simulates one batch item in its own span, marking the span
+// cancelled when ctx ends first.
+func (a *App) runBatchItem(ctx context.Context, index int) error {
+	ctx, span := a.tracer.Start(ctx, "batch_item")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch.item", index))
+	if err := sleepContext(ctx, workLatency(a.rng)); err != nil {
+		span.SetAttributes(attribute.Bool("cancelled", true))
+		if errors.Is(err, context.DeadlineExceeded) {
+			span.SetStatus(codes.Error, "batch deadline exceeded")
+		} else {
+			span.SetStatus(codes.Error, "cancelled")
+		}
+		return err
+	}
+	return nil
+}
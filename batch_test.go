@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestBatchHandlerDeadline(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.MinWorkLatency = 100 * time.Millisecond
+		c.MaxWorkLatency = 100 * time.Millisecond
+		c.BatchDeadline = 250 * time.Millisecond
+	})
+
+	w := httptest.NewRecorder()
+	app.serveBatch(w, httptest.NewRequest(http.MethodGet, "/batch?items=5", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var got batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := batchResult{Requested: 5, Completed: 2, Cancelled: 3, Partial: true}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	var finished, cancelled int
+	for _, span := range spanRecorder.Ended() {
+		if span.Name() != "batch_item" {
+			continue
+		}
+		if v, _ := spanAttribute(span, "cancelled"); v.AsBool() {
+			cancelled++
+			if span.Status().Code != codes.Error {
+				t.Errorf("Expected cancelled item status Error, got %v", span.Status().Code)
+			}
+		} else {
+			finished++
+		}
+	}
+	if finished != 2 || cancelled != 1 {
+		t.Errorf("Expected 2 finished and 1 cancelled item spans, got %d and %d", finished, cancelled)
+	}
+	if v, _ := spanAttribute(endedSpan(t, "batch"), "batch.partial"); !v.AsBool() {
+		t.Error("Expected batch.partial on the batch span")
+	}
+}
+
+func TestBatchHandlerInvalidItems(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	for _, items := range []string{"", "0", "many", "101"} {
+		w := httptest.NewRecorder()
+		app.serveBatch(w, httptest.NewRequest(http.MethodGet, "/batch?items="+items, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for items=%q, got %d", http.StatusBadRequest, items, w.Code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxJSONBodyBytes bounds the request bodies decodeJSONBody reads.
+const maxJSONBodyBytes = 1 << 20
+
+// decodeJSONBody strictly decodes the JSON object in r's body into dst:
+// unknown fields, trailing data and oversized bodies are rejected. The
+// returned error describes the problem so it can be sent back as a 400, or
+// as a 413 when it wraps an *http.MaxBytesError. w is told to close the
+// connection after an oversized body.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var maxErr *http.MaxBytesError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &maxErr):
+			return fmt.Errorf("request body too large: must be at most %d bytes: %w", maxErr.Limit, err)
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("malformed JSON body at byte %d: %w", syntaxErr.Offset, err)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("malformed JSON body: unexpected end of input")
+		case errors.As(err, &typeErr):
+			return fmt.Errorf("invalid JSON body: field %q must be %s", typeErr.Field, typeErr.Type)
+		case errors.Is(err, io.EOF):
+			return errors.New("invalid JSON body: body must not be empty")
+		default:
+			// Unknown fields are reported as plain errors by encoding/json
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+	}
+	if dec.More() {
+		return errors.New("invalid JSON body: must contain a single JSON object")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkHandlerJSONBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "malformed JSON",
+			body:       `{"type": "processing"`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "malformed JSON body",
+		},
+		{
+			name:       "syntax error",
+			body:       `{"type": processing}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "malformed JSON body at byte",
+		},
+		{
+			name:       "unknown field",
+			body:       `{"type": "processing", "priority": 1}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  `unknown field "priority"`,
+		},
+		{
+			name:       "wrong type",
+			body:       `{"duration_ms": "fast"}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  `field "duration_ms" must be int64`,
+		},
+		{
+			name:       "trailing data",
+			body:       `{"type": "processing"} {}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "single JSON object",
+		},
+		{
+			name:       "duration out of range",
+			body:       `{"duration_ms": 60000}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid duration_ms",
+		},
+		{
+			name:       "body too large",
+			body:       `{"type": "` + strings.Repeat("x", maxJSONBodyBytes) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantError:  "request body too large",
+		},
+		{
+			name:       "valid body",
+			body:       `{"type": "processing", "duration_ms": 1}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) { c.MaxWorkLatency = 10 * time.Millisecond })
+			errorRate.Store(0)
+			t.Cleanup(func() { errorRate.Store(appConfig.ErrorRate) })
+
+			w := httptest.NewRecorder()
+			app.serveWork(w, httptest.NewRequest(http.MethodPost, "/work", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			span := endedSpan(t, "do_work")
+			errAttr, _ := spanAttribute(span, "error")
+			if tt.wantError == "" {
+				if errAttr.AsBool() {
+					t.Error("Expected no error attribute on the span")
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("Expected error body containing %q, got %q", tt.wantError, w.Body.String())
+			}
+			if !errAttr.AsBool() {
+				t.Error("Expected error=true on the span")
+			}
+		})
+	}
+}
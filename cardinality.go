@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// seriesTracker counts the distinct attribute sets recorded per instrument so
+// operators can watch metric cardinality grow.
+type seriesTracker struct {
+	mu     sync.Mutex
+	series map[string]map[attribute.Distinct]struct{}
+}
+
+func newSeriesTracker() *seriesTracker {
+	return &seriesTracker{series: make(map[string]map[attribute.Distinct]struct{})}
+}
+
+// observe notes that instrument recorded a measurement with attrs.
+func (t *seriesTracker) observe(instrument string, attrs ...attribute.KeyValue) {
+	set := attribute.NewSet(attrs...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sets, ok := t.series[instrument]
+	if !ok {
+		sets = make(map[attribute.Distinct]struct{})
+		t.series[instrument] = sets
+	}
+	sets[set.Equivalent()] = struct{}{}
+}
+
+// counts returns the number of distinct attribute sets per instrument.
+func (t *seriesTracker) counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int, len(t.series))
+	for instrument, sets := range t.series {
+		counts[instrument] = len(sets)
+	}
+	return counts
+}
+
+// registerSeriesGauge reports t through the metric_series_count gauge.
+func registerSeriesGauge(m metric.Meter, t *seriesTracker) error {
+	_, err := m.Int64ObservableGauge(
+		"metric_series_count",
+		metric.WithDescription("Number of distinct attribute sets recorded per instrument"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			for instrument, n := range t.counts() {
+				o.Observe(int64(n), metric.WithAttributes(attribute.String("instrument", instrument)))
+			}
+			return nil
+		}),
+	)
+	return err
+}
+
+// reportCardinality logs the distinct attribute-set count per instrument
+// every interval until ctx is done, so cardinality growth shows up in logs.
+func reportCardinality(ctx context.Context, logger *slog.Logger, t *seriesTracker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			counts := t.counts()
+			instruments := make([]string, 0, len(counts))
+			for instrument := range counts {
+				instruments = append(instruments, instrument)
+			}
+			sort.Strings(instruments)
+
+			attrs := make([]slog.Attr, 0, len(instruments))
+			for _, instrument := range instruments {
+				attrs = append(attrs, slog.Int(instrument, counts[instrument]))
+			}
+			logger.LogAttrs(ctx, slog.LevelInfo, "metric cardinality report", slog.Any("series", slog.GroupValue(attrs...)))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSeriesCountGauge(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, endpoint := range []string{"/a", "/b", "/c", "/a"} {
+		app.countRequest(ctx,
+			attribute.String("endpoint", endpoint),
+			attribute.String("status", "200"),
+		)
+	}
+	app.recordDuration(ctx, 0.1, attribute.String("endpoint", "/a"))
+
+	m, ok := findMetric(collectMetrics(t), "metric_series_count")
+	if !ok {
+		t.Fatal("Expected metric_series_count to be collected")
+	}
+	gauge := m.Data.(metricdata.Gauge[int64])
+
+	tests := []struct {
+		name       string
+		instrument string
+		expected   int64
+	}{
+		{
+			name:       "counter series",
+			instrument: "http_requests_total",
+			expected:   3,
+		},
+		{
+			name:       "histogram series",
+			instrument: "http_request_duration_seconds",
+			expected:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dp := range gauge.DataPoints {
+				if hasAttributes(dp.Attributes, attribute.String("instrument", tt.instrument)) {
+					if dp.Value != tt.expected {
+						t.Errorf("Expected %d series for %s, got %d", tt.expected, tt.instrument, dp.Value)
+					}
+					return
+				}
+			}
+			t.Errorf("No metric_series_count data point for %s", tt.instrument)
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger goroutine and a reader.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReportCardinality(t *testing.T) {
+	tracker := newSeriesTracker()
+	for _, endpoint := range []string{"/a", "/b", "/c"} {
+		tracker.observe("http_requests_total", attribute.String("endpoint", endpoint))
+	}
+	tracker.observe("http_request_duration_seconds", attribute.String("endpoint", "/a"))
+
+	var out syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		reportCardinality(ctx, logger, tracker, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "metric cardinality report") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	line, _, _ := strings.Cut(out.String(), "\n")
+	var record struct {
+		Msg    string         `json:"msg"`
+		Series map[string]int `json:"series"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("Expected a cardinality report line, got %q: %v", out.String(), err)
+	}
+	if got := record.Series["http_requests_total"]; got != 3 {
+		t.Errorf("Expected http_requests_total series 3, got %d", got)
+	}
+	if got := record.Series["http_request_duration_seconds"]; got != 1 {
+		t.Errorf("Expected http_request_duration_seconds series 1, got %d", got)
+	}
+}
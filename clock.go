@@ -0,0 +1,31 @@
+package main
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clock supplies the timestamps of request spans. Tests swap in a fixed
+// clock so exported spans can be compared byte for byte with golden files.
+type clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// spanClock timestamps the spans started by startServerSpan.
+var spanClock clock = systemClock{}
+
+// clockSpan ends the wrapped span at spanClock's current time unless the
+// caller passes its own timestamp.
+type clockSpan struct {
+	trace.Span
+}
+
+func (s clockSpan) End(options ...trace.SpanEndOption) {
+	s.Span.End(append([]trace.SpanEndOption{trace.WithTimestamp(spanClock.Now())}, options...)...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// steppingClock starts at a fixed instant and advances by step on each read.
+type steppingClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// sequentialIDs generates predictable trace and span IDs.
+type sequentialIDs struct {
+	mu sync.Mutex
+	n  uint64
+}
+
+func (g *sequentialIDs) next() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return g.n
+}
+
+func (g *sequentialIDs) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	var tid trace.TraceID
+	binary.BigEndian.PutUint64(tid[8:], g.next())
+	return tid, g.NewSpanID(ctx, tid)
+}
+
+func (g *sequentialIDs) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	var sid trace.SpanID
+	binary.BigEndian.PutUint64(sid[:], g.next())
+	return sid
+}
+
+// goldenSpan is the stable part of an exported span compared with golden
+// files; the resource and SDK details are left out so SDK upgrades do not
+// churn the fixtures.
+type goldenSpan struct {
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	Attributes map[string]string `json:"attributes"`
+	Status     string            `json:"status"`
+}
+
+func TestServerSpanGolden(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	orig := spanClock
+	spanClock = &steppingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), step: 25 * time.Millisecond}
+	t.Cleanup(func() { spanClock = orig })
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithIDGenerator(&sequentialIDs{}),
+		sdktrace.WithSyncer(exporter),
+	)
+	defer provider.Shutdown(context.Background())
+	app.tracer = provider.Tracer("test-app")
+
+	app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 exported span, got %d", len(spans))
+	}
+	span := spans[0]
+	got := goldenSpan{
+		Name:       span.Name,
+		TraceID:    span.SpanContext.TraceID().String(),
+		SpanID:     span.SpanContext.SpanID().String(),
+		StartTime:  span.StartTime,
+		EndTime:    span.EndTime,
+		Attributes: make(map[string]string),
+		Status:     span.Status.Code.String(),
+	}
+	for _, attr := range span.Attributes {
+		got.Attributes[string(attr.Key)] = attr.Value.Emit()
+	}
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to serialize span: %v", err)
+	}
+	data = append(data, '\n')
+
+	golden := filepath.Join("testdata", "health_check_span.json")
+	if *update {
+		if err := os.WriteFile(golden, data, 0o644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Serialized span does not match %s\ngot:\n%s\nwant:\n%s", golden, data, want)
+	}
+}
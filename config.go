@@ -0,0 +1,1131 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Config holds the runtime configuration of the sample app. Values are read
+// from the environment by LoadConfigFromEnv and may then be overridden by
+// command-line flags registered with RegisterFlags.
+type Config struct {
+	// ServiceName, ServiceVersion and Environment describe the service on
+	// the resource.
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+	// ReleaseID identifies the deployed release; when set it is recorded on
+	// the resource and on root spans.
+	ReleaseID string
+	// GlobalAttributes are added to the resource and to every span so that
+	// fleet-wide dimensions such as the cluster name need no per-call code.
+	GlobalAttributes []attribute.KeyValue
+	// ErrorCounterAttributes are static attributes, e.g. severity=warning,
+	// merged into every metric_record_errors_total measurement.
+	ErrorCounterAttributes []attribute.KeyValue
+
+	// Port is the TCP port the HTTP server listens on, on every interface.
+	Port string
+	// Addr is the host:port the HTTP server listens on, such as
+	// 127.0.0.1:8080; it takes precedence over Port when set.
+	Addr string
+	// ListenNetwork selects the address family of the listener: "tcp" binds
+	// both IPv4 and IPv6 (dual-stack), "tcp4" and "tcp6" bind a single family.
+	ListenNetwork string
+
+	// ListenRetries is how many more times binding is attempted when the
+	// port is in use; ListenRetryBackoff is the first wait between attempts,
+	// doubled after each.
+	ListenRetries      int
+	ListenRetryBackoff time.Duration
+
+	// TrailingSlash is how a path with a trailing slash that only matches a
+	// route without it, such as /work/, is handled: "strip" serves it as
+	// that route, "redirect" answers 308 Permanent Redirect to it and
+	// "strict" leaves it to 404.
+	TrailingSlash string
+	// RouteMethods lists the methods each route accepts, with HEAD implied
+	// by GET; OPTIONS requests to a listed route are answered automatically
+	// and other methods are rejected with 405. Unlisted routes accept every
+	// method.
+	RouteMethods map[string][]string
+
+	// ShutdownTimeout bounds how long in-flight requests are drained on
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSMinVersion is the oldest TLS version, "1.2" or "1.3", the server
+	// accepts and the exporters negotiate with the collector.
+	TLSMinVersion string
+
+	// HeaderAttributes maps inbound request headers to span attributes,
+	// optionally allowlisting the values recorded.
+	HeaderAttributes []headerAttribute
+
+	// SpanProcessor selects how spans reach the exporter: "batch" queues and
+	// exports them in the background, "simple" exports each span
+	// synchronously when it ends.
+	SpanProcessor string
+	// SensitiveAttributeKeys lists span attribute keys that are redacted
+	// before spans are exported.
+	SensitiveAttributeKeys []string
+	// RedactionMode is "remove" to drop sensitive attributes or "hash" to
+	// replace their values with a SHA-256 digest.
+	RedactionMode string
+
+	// MinWorkLatency and MaxWorkLatency bound the simulated latency of /work:
+	// each request sleeps at least MinWorkLatency plus a random portion that
+	// keeps the total below MaxWorkLatency.
+	MinWorkLatency time.Duration
+	MaxWorkLatency time.Duration
+	// WorkDeadline caps the simulated work of a /work request, including
+	// the downstream call and its retries; work still running when it
+	// passes is cancelled.
+	WorkDeadline time.Duration
+	// CoalesceWork makes concurrent /work requests with the same
+	// idempotency key share a single execution.
+	CoalesceWork bool
+	// DownstreamURL, when set, is called by /work to simulate a downstream
+	// dependency; OutboundPropagator picks the trace context format injected
+	// into that call ("tracecontext" or "b3"), independently of the inbound
+	// format.
+	DownstreamURL      string
+	OutboundPropagator string
+	// DownstreamMaxConcurrency caps the downstream calls in flight at once;
+	// further calls wait for a slot. Zero leaves them unbounded.
+	DownstreamMaxConcurrency int
+	// DownstreamRetries is how many more times a failed downstream call is
+	// attempted; DownstreamRetryBackoff is the first wait between attempts,
+	// doubled after each.
+	DownstreamRetries      int
+	DownstreamRetryBackoff time.Duration
+	// RetryTelemetryMode is how retried operations are traced: "events"
+	// records each failed attempt as an event on the current span, "spans"
+	// runs each attempt in its own child span named "attempt N".
+	RetryTelemetryMode string
+	// BatchDeadline caps the total time of a /batch request; items still
+	// pending when it passes are cancelled.
+	BatchDeadline time.Duration
+	// WorkTypes are the work.type values /work draws from when the request
+	// does not pick one with ?type=.
+	WorkTypes []string
+	// ExperimentVariants are the A/B variants recorded from the
+	// X-Experiment-Variant header or experiment_variant cookie; any other
+	// value is recorded as "other". Empty disables variant tagging.
+	ExperimentVariants []string
+	// TenantMetricKey, when set, labels the request metrics with the
+	// upstream tenant.id baggage member under this key, standing in for a
+	// per-tenant resource attribute. Empty disables it.
+	TenantMetricKey string
+	// MetricTenants are the tenants TenantMetricKey records by name; any
+	// other tenant is recorded as "other", so callers cannot grow the
+	// metrics' cardinality. It is required when TenantMetricKey is set.
+	MetricTenants []string
+	// ErrorRate is the initial probability (0.0-1.0) that a /work request
+	// fails; it can be changed at runtime.
+	ErrorRate float64
+	// NestedErrorRate is the probability (0.0-1.0) that the nested work a
+	// request simulates is marked as errored.
+	NestedErrorRate float64
+	// ErrorRateFile, when set, holds the error rate applied on SIGHUP;
+	// without it SIGHUP restores ErrorRate.
+	ErrorRateFile string
+	// FeatureFlags are the feature flags enabled at startup; they can be
+	// switched at runtime.
+	FeatureFlags []string
+	// ThrottleRate is the probability (0.0-1.0) that /work sheds a request
+	// with 429 Too Many Requests instead of processing it, telling the
+	// client to retry after ThrottleRetryAfter.
+	ThrottleRate       float64
+	ThrottleRetryAfter time.Duration
+
+	// HistogramDisabledEndpoints lists endpoints whose request durations are
+	// not recorded; their requests are still counted.
+	HistogramDisabledEndpoints []string
+	// AccessLogDisabledEndpoints lists endpoints whose requests are not
+	// written to the access log, such as a frequently probed /health.
+	AccessLogDisabledEndpoints []string
+	// AccessLogSampling logs only one request in N to the endpoints it
+	// lists, e.g. {"/health": 10}; other endpoints log every request.
+	AccessLogSampling map[string]int
+	// LogFormat is how console logs are written: "text" or "json".
+	LogFormat string
+	// DurationBuckets are the explicit bucket boundaries, in seconds, of
+	// http_request_duration_seconds.
+	DurationBuckets []float64
+	// DurationQuantileWindow is the number of recent durations per endpoint
+	// used to estimate p50/p95/p99 client-side; zero disables the estimate.
+	DurationQuantileWindow int
+
+	// CardinalityReportInterval is how often the series count per
+	// instrument is logged; zero disables the report.
+	CardinalityReportInterval time.Duration
+
+	// AdminToken is the bearer token required by the /admin endpoints; they
+	// are disabled when it is empty.
+	AdminToken string
+	// MaxMemSpikeMB bounds the allocation /admin/memspike may make, alone
+	// and across concurrent requests.
+	MaxMemSpikeMB int
+	// MetricPauseMode decides what happens to the samples recorded while
+	// /admin/metrics/pause has paused exports: "buffer" keeps cumulative
+	// temporality and flushes them on resume, "drop" exports counters and
+	// histograms as deltas so they are lost.
+	MetricPauseMode string
+
+	// MaxSpansPerTrace caps the spans exported per trace; further spans are
+	// dropped and the root is flagged as truncated. Zero means no cap.
+	MaxSpansPerTrace int
+	// MaxAttributeValueLength caps, in characters, the string attribute
+	// values on every exported span; longer values are cut short and end in
+	// an ellipsis. Zero means no cap.
+	MaxAttributeValueLength int
+	// DropHealthySpans withholds /health spans that answered 200 from
+	// export, keeping the failed health checks.
+	DropHealthySpans bool
+
+	// RecordGoroutines records runtime.goroutines, the goroutine count at
+	// request start, on request spans for debugging.
+	RecordGoroutines bool
+
+	// CaptureTrafficSource records the Referer and Origin request headers
+	// on request spans to show where traffic comes from. Disable it when
+	// those URLs must not leave the service.
+	CaptureTrafficSource bool
+
+	// GCPauseEvents adds a gc.pause event to request spans for each garbage
+	// collection that completed during the request.
+	GCPauseEvents bool
+	// RuntimeMetricsInterval is the minimum time between reads of the Go
+	// runtime's memory statistics for the runtime metrics; zero disables
+	// the runtime metrics.
+	RuntimeMetricsInterval time.Duration
+
+	// TraceEndpoint and MetricEndpoint are the full OTLP/HTTP URLs spans and
+	// metrics are exported to. LoadConfigFromEnv fills them from the
+	// standard OTEL_EXPORTER_OTLP_* variables; empty leaves the exporter
+	// defaults.
+	TraceEndpoint  string
+	MetricEndpoint string
+	// LogEndpoint is the full OTLP URL logs are exported to, from
+	// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT. When
+	// it is empty logs are only written to the console.
+	LogEndpoint string
+	// Insecure exports over plain HTTP instead of TLS.
+	Insecure bool
+	// PrometheusEnabled additionally exposes the metrics for scraping at
+	// /prometheus; they are still pushed over OTLP.
+	PrometheusEnabled bool
+	// SDKSelfObservability turns on the SDK's experimental metrics about
+	// itself, such as otel.sdk.span.started and the batch processor's queue
+	// size. They are exported with the app's metrics under the SDK's own
+	// instrumentation scope.
+	SDKSelfObservability bool
+	// RequireGauges fails startup when an observable gauge cannot be
+	// registered, instead of logging it and running without that gauge.
+	RequireGauges bool
+
+	// OTLPProtocol is the OTLP transport, "http" (or "http/protobuf") or
+	// "grpc"; OTLPTraceProtocol, OTLPMetricProtocol and OTLPLogProtocol
+	// override it per signal when set.
+	OTLPProtocol       string
+	OTLPTraceProtocol  string
+	OTLPMetricProtocol string
+	OTLPLogProtocol    string
+
+	// OTLPTraceURLPath and OTLPMetricURLPath override the HTTP paths the
+	// OTLP exporters post to, for collectors behind a gateway; empty keeps
+	// the default /v1/traces and /v1/metrics.
+	OTLPTraceURLPath  string
+	OTLPMetricURLPath string
+
+	// TelemetryInitTimeout bounds how long exporter creation may take at
+	// startup.
+	TelemetryInitTimeout time.Duration
+	// TelemetryFailureMode decides what happens when telemetry cannot be
+	// initialized: "exit" stops the process, "degraded" still starts the
+	// server but serves only /health, returning 503 with the reason.
+	TelemetryFailureMode string
+	// TelemetryInitMaxElapsed, when positive, makes startup wait for the
+	// collector: init is retried with exponential backoff starting at
+	// TelemetryInitRetryInterval until it succeeds or this much time passed.
+	TelemetryInitMaxElapsed    time.Duration
+	TelemetryInitRetryInterval time.Duration
+
+	// TraceSampler names the head sampler using the OTEL_TRACES_SAMPLER
+	// vocabulary (always_on, always_off, traceidratio and their parentbased_
+	// variants); TraceSamplerArg is the ratio for the ratio-based samplers.
+	TraceSampler    string
+	TraceSamplerArg string
+	// SampleRatio is the share (0.0-1.0) of new traces to record. Below 1.0
+	// it selects a parent-based trace ID ratio sampler, so children still
+	// follow their parent's decision; it cannot be combined with a
+	// TraceSampler other than the default or a TraceSamplerArg.
+	SampleRatio float64
+	// TraceRouteSampleRatios overrides the sampling ratio for request spans
+	// by route, e.g. {"/work": 1.0, "/health": 0.0}.
+	TraceRouteSampleRatios map[string]float64
+	// ForceSampleRequestBytes forces sampling of requests whose
+	// Content-Length exceeds it, regardless of the sampler; zero disables it.
+	ForceSampleRequestBytes int64
+	// RecordSamplingSource records sampling.decision_source on sampled
+	// spans: "parent" when a ParentBased sampler followed the parent's
+	// decision, "local" when the sampler decided itself.
+	RecordSamplingSource bool
+
+	// errs collects environment values that failed to parse; Validate
+	// reports them.
+	errs []error
+}
+
+// LoadConfigFromEnv builds a Config from environment variables, falling back
+// to defaults for anything unset.
+func LoadConfigFromEnv() *Config {
+	c := &Config{
+		ServiceName:    envOrDefault("OTEL_SERVICE_NAME", "sample-app"),
+		ServiceVersion: envOrDefault("SERVICE_VERSION", "1.0.0"),
+		Environment:    envOrDefault("DEPLOYMENT_ENVIRONMENT", "kubernetes"),
+		ReleaseID:      os.Getenv("RELEASE_ID"),
+
+		Port:          envOrDefault("PORT", "8080"),
+		Addr:          os.Getenv("ADDR"),
+		ListenNetwork: envOrDefault("LISTEN_NETWORK", "tcp"),
+		TLSCertFile:   os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:    os.Getenv("TLS_KEY_FILE"),
+		TLSMinVersion: envOrDefault("TLS_MIN_VERSION", "1.2"),
+
+		SpanProcessor:          envOrDefault("SPAN_PROCESSOR", "batch"),
+		SensitiveAttributeKeys: splitList(os.Getenv("SENSITIVE_ATTRIBUTE_KEYS")),
+		RedactionMode:          envOrDefault("REDACTION_MODE", "remove"),
+
+		WorkTypes:          splitList(envOrDefault("WORK_TYPES", "processing")),
+		ExperimentVariants: splitList(os.Getenv("EXPERIMENT_VARIANTS")),
+		FeatureFlags:       splitList(os.Getenv("FEATURE_FLAGS")),
+		TenantMetricKey:    os.Getenv("TENANT_METRIC_KEY"),
+		MetricTenants:      splitList(os.Getenv("METRIC_TENANTS")),
+
+		DownstreamURL:      os.Getenv("DOWNSTREAM_URL"),
+		OutboundPropagator: envOrDefault("OUTBOUND_PROPAGATOR", "tracecontext"),
+
+		HistogramDisabledEndpoints: splitList(os.Getenv("HISTOGRAM_DISABLED_ENDPOINTS")),
+		AccessLogDisabledEndpoints: splitList(os.Getenv("ACCESS_LOG_DISABLED_ENDPOINTS")),
+		LogFormat:                  envOrDefault("LOG_FORMAT", "text"),
+
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
+		MetricPauseMode: envOrDefault("METRIC_PAUSE_MODE", "buffer"),
+
+		TraceEndpoint:  otlpEndpoint("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "/v1/traces"),
+		MetricEndpoint: otlpEndpoint("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "/v1/metrics"),
+		LogEndpoint:    otlpEndpoint("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "/v1/logs"),
+
+		TelemetryFailureMode: envOrDefault("TELEMETRY_FAILURE_MODE", "exit"),
+
+		OTLPProtocol:       envOrDefault("OTEL_EXPORTER_OTLP_PROTOCOL", "http"),
+		OTLPTraceProtocol:  os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"),
+		OTLPMetricProtocol: os.Getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL"),
+		OTLPLogProtocol:    os.Getenv("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL"),
+
+		OTLPTraceURLPath:  os.Getenv("OTLP_TRACE_URL_PATH"),
+		OTLPMetricURLPath: os.Getenv("OTLP_METRIC_URL_PATH"),
+
+		TraceSampler:    envOrDefault("OTEL_TRACES_SAMPLER", defaultTraceSampler),
+		TraceSamplerArg: os.Getenv("OTEL_TRACES_SAMPLER_ARG"),
+	}
+	c.GlobalAttributes = c.envAttributes("GLOBAL_ATTRIBUTES")
+	c.ErrorCounterAttributes = c.envAttributes("ERROR_COUNTER_ATTRIBUTES")
+	c.TraceRouteSampleRatios = c.envRouteRatios("TRACE_ROUTE_SAMPLE_RATIOS")
+	c.SampleRatio = c.envFloat("TRACE_SAMPLE_RATIO", 1.0)
+	c.HeaderAttributes = c.envHeaderAttributes("HEADER_ATTRIBUTES")
+	c.DurationQuantileWindow = c.envInt("DURATION_QUANTILE_WINDOW", 0)
+	c.DurationBuckets = c.envBuckets("DURATION_BUCKETS", defaultDurationBuckets)
+	c.MaxMemSpikeMB = c.envInt("MAX_MEMSPIKE_MB", 256)
+	c.ListenRetries = c.envInt("LISTEN_RETRIES", 0)
+	c.DownstreamMaxConcurrency = c.envInt("DOWNSTREAM_MAX_CONCURRENCY", 0)
+	c.DownstreamRetries = c.envInt("DOWNSTREAM_RETRIES", 0)
+	c.DownstreamRetryBackoff = c.envDuration("DOWNSTREAM_RETRY_BACKOFF", 100*time.Millisecond)
+	c.RetryTelemetryMode = envOrDefault("RETRY_TELEMETRY_MODE", "events")
+	c.ListenRetryBackoff = c.envDuration("LISTEN_RETRY_BACKOFF", time.Second)
+	c.TrailingSlash = envOrDefault("TRAILING_SLASH", "strip")
+	c.AccessLogSampling = c.envAccessLogSampling("ACCESS_LOG_SAMPLING")
+	c.RouteMethods = c.envRouteMethods("ROUTE_METHODS", defaultRouteMethods)
+	c.ShutdownTimeout = c.envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	c.MaxSpansPerTrace = c.envInt("MAX_SPANS_PER_TRACE", 0)
+	c.MaxAttributeValueLength = c.envInt("MAX_ATTRIBUTE_VALUE_LENGTH", 0)
+	c.DropHealthySpans = c.envBool("DROP_HEALTHY_SPANS", false)
+	c.CardinalityReportInterval = c.envDuration("CARDINALITY_REPORT_INTERVAL", 0)
+	c.ForceSampleRequestBytes = int64(c.envInt("FORCE_SAMPLE_REQUEST_BYTES", 0))
+	c.RecordSamplingSource = c.envBool("RECORD_SAMPLING_SOURCE", false)
+	c.GCPauseEvents = c.envBool("GC_PAUSE_EVENTS", false)
+	c.RuntimeMetricsInterval = c.envDuration("RUNTIME_METRICS_INTERVAL", 15*time.Second)
+	c.RecordGoroutines = c.envBool("RECORD_GOROUTINES", false)
+	c.CaptureTrafficSource = c.envBool("CAPTURE_TRAFFIC_SOURCE", true)
+	c.Insecure = c.envBool("OTEL_EXPORTER_OTLP_INSECURE", true)
+	c.PrometheusEnabled = c.envBool("PROMETHEUS_ENABLED", false)
+	c.SDKSelfObservability = c.envBool(sdkSelfObservabilityEnv, false)
+	c.RequireGauges = c.envBool("REQUIRE_GAUGES", false)
+	c.TelemetryInitTimeout = c.envDuration("TELEMETRY_INIT_TIMEOUT", 10*time.Second)
+	c.TelemetryInitMaxElapsed = c.envDuration("TELEMETRY_INIT_MAX_ELAPSED", 0)
+	c.TelemetryInitRetryInterval = c.envDuration("TELEMETRY_INIT_RETRY_INTERVAL", time.Second)
+	c.MinWorkLatency = c.envDuration("MIN_WORK_LATENCY", 0)
+	c.MaxWorkLatency = c.envDuration("MAX_WORK_LATENCY", 500*time.Millisecond)
+	c.WorkDeadline = c.envDuration("WORK_DEADLINE", 10*time.Second)
+	c.BatchDeadline = c.envDuration("BATCH_DEADLINE", 10*time.Second)
+	c.CoalesceWork = c.envBool("COALESCE_WORK", false)
+	c.ErrorRate = c.envFloat("ERROR_RATE", 0.05)
+	c.NestedErrorRate = c.envFloat("NESTED_ERROR_RATE", 0.1)
+	c.ErrorRateFile = os.Getenv("ERROR_RATE_FILE")
+	c.ThrottleRate = c.envFloat("THROTTLE_RATE", 0)
+	c.ThrottleRetryAfter = c.envDuration("THROTTLE_RETRY_AFTER", time.Second)
+	return c
+}
+
+// RegisterFlags binds command-line flags to the fields of c, using the
+// current field values as defaults so flags take precedence over the
+// environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ServiceName, "service-name", c.ServiceName, "service.name recorded on the resource (env OTEL_SERVICE_NAME)")
+	fs.StringVar(&c.ServiceVersion, "service-version", c.ServiceVersion, "service.version recorded on the resource (env SERVICE_VERSION)")
+	fs.StringVar(&c.Environment, "environment", c.Environment, "deployment.environment recorded on the resource (env DEPLOYMENT_ENVIRONMENT)")
+	fs.StringVar(&c.ReleaseID, "release-id", c.ReleaseID, "release identifier recorded on the resource and root spans (env RELEASE_ID)")
+	fs.Var((*attributeList)(&c.GlobalAttributes), "global-attributes", "comma-separated key=value attributes added to the resource and every span (env GLOBAL_ATTRIBUTES)")
+	fs.Var((*attributeList)(&c.ErrorCounterAttributes), "error-counter-attributes", "comma-separated key=value attributes added to every metric_record_errors_total measurement (env ERROR_COUNTER_ATTRIBUTES)")
+	fs.StringVar(&c.Port, "port", c.Port, "TCP port to listen on (env PORT)")
+	fs.StringVar(&c.Addr, "addr", c.Addr, "host:port to listen on, such as 127.0.0.1:8080; overrides -port (env ADDR)")
+	fs.StringVar(&c.ListenNetwork, "listen-network", c.ListenNetwork, "listener address family: tcp (dual-stack), tcp4 or tcp6 (env LISTEN_NETWORK)")
+	fs.IntVar(&c.ListenRetries, "listen-retries", c.ListenRetries, "extra attempts to bind the port when it is in use (env LISTEN_RETRIES)")
+	fs.DurationVar(&c.ListenRetryBackoff, "listen-retry-backoff", c.ListenRetryBackoff, "first wait between bind attempts, doubled after each (env LISTEN_RETRY_BACKOFF)")
+	fs.StringVar(&c.TrailingSlash, "trailing-slash", c.TrailingSlash, "paths like /work/: strip to serve the route without the slash, redirect to it, or strict to 404 (env TRAILING_SLASH)")
+	fs.Func("route-methods", "comma-separated route=METHOD|METHOD allowlists; HEAD is allowed with GET, OPTIONS to a listed route is answered automatically and other methods get 405 (env ROUTE_METHODS)", func(v string) error {
+		routes, err := parseRouteMethods(v)
+		if err != nil {
+			return err
+		}
+		c.RouteMethods = routes
+		return nil
+	})
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "maximum time to drain in-flight requests on SIGINT or SIGTERM (env SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "PEM certificate for serving HTTPS; requires -tls-key-file (env TLS_CERT_FILE)")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "PEM private key for serving HTTPS; requires -tls-cert-file (env TLS_KEY_FILE)")
+	fs.StringVar(&c.TLSMinVersion, "tls-min-version", c.TLSMinVersion, "oldest TLS version served and used for exports: 1.2 or 1.3 (env TLS_MIN_VERSION)")
+	fs.Func("header-attributes", "comma-separated Header=attribute.key mappings recorded on request spans, each optionally allowlisted with :value1|value2 (env HEADER_ATTRIBUTES)", func(v string) error {
+		mappings, err := parseHeaderAttributes(v)
+		if err != nil {
+			return err
+		}
+		c.HeaderAttributes = mappings
+		return nil
+	})
+	fs.StringVar(&c.SpanProcessor, "span-processor", c.SpanProcessor, "span processor: batch or simple (synchronous export) (env SPAN_PROCESSOR)")
+	fs.Var((*stringList)(&c.SensitiveAttributeKeys), "sensitive-attribute-keys", "comma-separated span attribute keys to redact before export (env SENSITIVE_ATTRIBUTE_KEYS)")
+	fs.StringVar(&c.RedactionMode, "redaction-mode", c.RedactionMode, "how sensitive attributes are redacted: remove or hash (env REDACTION_MODE)")
+	fs.DurationVar(&c.MinWorkLatency, "min-work-latency", c.MinWorkLatency, "minimum simulated latency of /work (env MIN_WORK_LATENCY)")
+	fs.DurationVar(&c.MaxWorkLatency, "max-work-latency", c.MaxWorkLatency, "maximum simulated latency of /work (env MAX_WORK_LATENCY)")
+	fs.DurationVar(&c.WorkDeadline, "work-deadline", c.WorkDeadline, "maximum time of the simulated work of a /work request, including the downstream call, before it is cancelled (env WORK_DEADLINE)")
+	fs.BoolVar(&c.CoalesceWork, "coalesce-work", c.CoalesceWork, "share one execution among concurrent /work requests with the same idempotency key (env COALESCE_WORK)")
+	fs.StringVar(&c.DownstreamURL, "downstream-url", c.DownstreamURL, "URL /work calls to simulate a downstream dependency; empty disables the call (env DOWNSTREAM_URL)")
+	fs.StringVar(&c.OutboundPropagator, "outbound-propagator", c.OutboundPropagator, "trace context format injected into downstream calls: tracecontext or b3 (env OUTBOUND_PROPAGATOR)")
+	fs.IntVar(&c.DownstreamMaxConcurrency, "downstream-max-concurrency", c.DownstreamMaxConcurrency, "most downstream calls in flight at once, further calls wait; 0 is unbounded (env DOWNSTREAM_MAX_CONCURRENCY)")
+	fs.IntVar(&c.DownstreamRetries, "downstream-retries", c.DownstreamRetries, "extra attempts at a failed downstream call (env DOWNSTREAM_RETRIES)")
+	fs.DurationVar(&c.DownstreamRetryBackoff, "downstream-retry-backoff", c.DownstreamRetryBackoff, "first wait between downstream attempts, doubled after each (env DOWNSTREAM_RETRY_BACKOFF)")
+	fs.StringVar(&c.RetryTelemetryMode, "retry-telemetry-mode", c.RetryTelemetryMode, "how retries are traced: events on the current span, or spans for a child span per attempt (env RETRY_TELEMETRY_MODE)")
+	fs.DurationVar(&c.BatchDeadline, "batch-deadline", c.BatchDeadline, "maximum total time of a /batch request before pending items are cancelled (env BATCH_DEADLINE)")
+	fs.Var((*stringList)(&c.WorkTypes), "work-types", "comma-separated work.type values /work chooses from (env WORK_TYPES)")
+	fs.Var((*stringList)(&c.ExperimentVariants), "experiment-variants", "comma-separated experiment variants recorded on request spans and metrics; empty disables (env EXPERIMENT_VARIANTS)")
+	fs.StringVar(&c.TenantMetricKey, "tenant-metric-key", c.TenantMetricKey, "attribute key labelling request metrics with the tenant.id baggage member, e.g. service.namespace; empty disables (env TENANT_METRIC_KEY)")
+	fs.Var((*stringList)(&c.MetricTenants), "metric-tenants", "comma-separated tenants -tenant-metric-key records by name; others are recorded as other (env METRIC_TENANTS)")
+	fs.Var((*stringList)(&c.FeatureFlags), "feature-flags", "comma-separated feature flags enabled at startup (env FEATURE_FLAGS)")
+	fs.Float64Var(&c.ErrorRate, "error-rate", c.ErrorRate, "initial probability (0.0-1.0) that a /work request fails (env ERROR_RATE)")
+	fs.Float64Var(&c.NestedErrorRate, "nested-error-rate", c.NestedErrorRate, "probability (0.0-1.0) that simulated nested work is marked as errored (env NESTED_ERROR_RATE)")
+	fs.StringVar(&c.ErrorRateFile, "error-rate-file", c.ErrorRateFile, "file holding the error rate applied on SIGHUP; unset restores -error-rate (env ERROR_RATE_FILE)")
+	fs.Float64Var(&c.ThrottleRate, "throttle-rate", c.ThrottleRate, "probability (0.0-1.0) that /work answers 429 with Retry-After instead of processing (env THROTTLE_RATE)")
+	fs.DurationVar(&c.ThrottleRetryAfter, "throttle-retry-after", c.ThrottleRetryAfter, "Retry-After sent with throttled /work responses, rounded up to whole seconds (env THROTTLE_RETRY_AFTER)")
+	fs.Var((*stringList)(&c.HistogramDisabledEndpoints), "histogram-disabled-endpoints", "comma-separated endpoints whose request durations are not recorded (env HISTOGRAM_DISABLED_ENDPOINTS)")
+	fs.Var((*stringList)(&c.AccessLogDisabledEndpoints), "access-log-disabled-endpoints", "comma-separated endpoints whose requests are not access logged (env ACCESS_LOG_DISABLED_ENDPOINTS)")
+	fs.Func("access-log-sampling", "comma-separated endpoint=N pairs access logging one request in N, e.g. /health=10 (env ACCESS_LOG_SAMPLING)", func(v string) error {
+		rates, err := parseAccessLogSampling(v)
+		if err != nil {
+			return err
+		}
+		c.AccessLogSampling = rates
+		return nil
+	})
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "console log format: text or json (env LOG_FORMAT)")
+	fs.Func("duration-buckets", "comma-separated bucket boundaries in seconds for http_request_duration_seconds (env DURATION_BUCKETS)", func(v string) error {
+		buckets, err := parseBuckets(v)
+		if err != nil {
+			return err
+		}
+		c.DurationBuckets = buckets
+		return nil
+	})
+	fs.IntVar(&c.DurationQuantileWindow, "duration-quantile-window", c.DurationQuantileWindow, "recent durations per endpoint used to estimate p50/p95/p99; 0 disables (env DURATION_QUANTILE_WINDOW)")
+	fs.DurationVar(&c.CardinalityReportInterval, "cardinality-report-interval", c.CardinalityReportInterval, "how often to log the series count per instrument; 0 disables (env CARDINALITY_REPORT_INTERVAL)")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "bearer token required by the /admin endpoints; empty disables them (env ADMIN_TOKEN)")
+	fs.IntVar(&c.MaxMemSpikeMB, "max-memspike-mb", c.MaxMemSpikeMB, "largest allocation /admin/memspike may make, in MB (env MAX_MEMSPIKE_MB)")
+	fs.StringVar(&c.MetricPauseMode, "metric-pause-mode", c.MetricPauseMode, "samples recorded while metric exports are paused: buffer (flush on resume) or drop (delta temporality) (env METRIC_PAUSE_MODE)")
+	fs.IntVar(&c.MaxSpansPerTrace, "max-spans-per-trace", c.MaxSpansPerTrace, "spans exported per trace before truncation; 0 disables the cap (env MAX_SPANS_PER_TRACE)")
+	fs.IntVar(&c.MaxAttributeValueLength, "max-attribute-value-length", c.MaxAttributeValueLength, "characters kept of string attribute values on exported spans, ending in an ellipsis when cut; 0 disables the cap (env MAX_ATTRIBUTE_VALUE_LENGTH)")
+	fs.BoolVar(&c.DropHealthySpans, "drop-healthy-spans", c.DropHealthySpans, "withhold /health spans that answered 200 from export, keeping failed checks (env DROP_HEALTHY_SPANS)")
+	fs.BoolVar(&c.RecordGoroutines, "record-goroutines", c.RecordGoroutines, "record the goroutine count at request start on request spans (env RECORD_GOROUTINES)")
+	fs.BoolVar(&c.CaptureTrafficSource, "capture-traffic-source", c.CaptureTrafficSource, "record the Referer and Origin request headers on request spans (env CAPTURE_TRAFFIC_SOURCE)")
+	fs.BoolVar(&c.GCPauseEvents, "gc-pause-events", c.GCPauseEvents, "add gc.pause events to request spans for collections during the request (env GC_PAUSE_EVENTS)")
+	fs.DurationVar(&c.RuntimeMetricsInterval, "runtime-metrics-interval", c.RuntimeMetricsInterval, "minimum time between reads of Go runtime memory statistics for the runtime metrics; 0 disables them (env RUNTIME_METRICS_INTERVAL)")
+	fs.Int64Var(&c.ForceSampleRequestBytes, "force-sample-request-bytes", c.ForceSampleRequestBytes, "always sample requests whose Content-Length exceeds this many bytes; 0 disables (env FORCE_SAMPLE_REQUEST_BYTES)")
+	fs.BoolVar(&c.RecordSamplingSource, "record-sampling-source", c.RecordSamplingSource, "record whether each sampling decision came from the parent or the local sampler (env RECORD_SAMPLING_SOURCE)")
+	fs.StringVar(&c.TraceEndpoint, "trace-endpoint", c.TraceEndpoint, "OTLP/HTTP URL spans are exported to (env OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT plus /v1/traces)")
+	fs.StringVar(&c.MetricEndpoint, "metric-endpoint", c.MetricEndpoint, "OTLP/HTTP URL metrics are exported to (env OTEL_EXPORTER_OTLP_METRICS_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT plus /v1/metrics)")
+	fs.StringVar(&c.LogEndpoint, "log-endpoint", c.LogEndpoint, "OTLP URL logs are exported to; empty logs to the console only (env OTEL_EXPORTER_OTLP_LOGS_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT plus /v1/logs)")
+	fs.BoolVar(&c.Insecure, "insecure", c.Insecure, "export telemetry over plain HTTP instead of TLS (env OTEL_EXPORTER_OTLP_INSECURE)")
+	fs.BoolVar(&c.PrometheusEnabled, "prometheus", c.PrometheusEnabled, "also serve metrics for Prometheus scraping at /prometheus (env PROMETHEUS_ENABLED)")
+	fs.BoolVar(&c.SDKSelfObservability, "sdk-self-observability", c.SDKSelfObservability, "export the SDK's own otel.sdk.* metrics, such as span queue sizes (env OTEL_GO_X_SELF_OBSERVABILITY)")
+	fs.BoolVar(&c.RequireGauges, "require-gauges", c.RequireGauges, "fail startup when an observable gauge cannot be registered instead of skipping it (env REQUIRE_GAUGES)")
+	fs.StringVar(&c.OTLPProtocol, "otlp-protocol", c.OTLPProtocol, "OTLP transport: http or grpc (env OTEL_EXPORTER_OTLP_PROTOCOL)")
+	fs.StringVar(&c.OTLPTraceProtocol, "otlp-trace-protocol", c.OTLPTraceProtocol, "OTLP transport for spans, overriding -otlp-protocol: http or grpc (env OTEL_EXPORTER_OTLP_TRACES_PROTOCOL)")
+	fs.StringVar(&c.OTLPMetricProtocol, "otlp-metric-protocol", c.OTLPMetricProtocol, "OTLP transport for metrics, overriding -otlp-protocol: http or grpc (env OTEL_EXPORTER_OTLP_METRICS_PROTOCOL)")
+	fs.StringVar(&c.OTLPLogProtocol, "otlp-log-protocol", c.OTLPLogProtocol, "OTLP transport for logs, overriding -otlp-protocol: http or grpc (env OTEL_EXPORTER_OTLP_LOGS_PROTOCOL)")
+	fs.StringVar(&c.OTLPTraceURLPath, "otlp-trace-url-path", c.OTLPTraceURLPath, "HTTP path the trace exporter posts to; empty uses /v1/traces (env OTLP_TRACE_URL_PATH)")
+	fs.StringVar(&c.OTLPMetricURLPath, "otlp-metric-url-path", c.OTLPMetricURLPath, "HTTP path the metric exporter posts to; empty uses /v1/metrics (env OTLP_METRIC_URL_PATH)")
+	fs.StringVar(&c.TelemetryFailureMode, "telemetry-failure-mode", c.TelemetryFailureMode, "on telemetry init failure: exit, or degraded to serve only a failing /health (env TELEMETRY_FAILURE_MODE)")
+	fs.DurationVar(&c.TelemetryInitTimeout, "telemetry-init-timeout", c.TelemetryInitTimeout, "maximum time to create the telemetry exporters at startup (env TELEMETRY_INIT_TIMEOUT)")
+	fs.DurationVar(&c.TelemetryInitMaxElapsed, "telemetry-init-max-elapsed", c.TelemetryInitMaxElapsed, "how long to retry telemetry init while the collector is unreachable; 0 disables retries (env TELEMETRY_INIT_MAX_ELAPSED)")
+	fs.DurationVar(&c.TelemetryInitRetryInterval, "telemetry-init-retry-interval", c.TelemetryInitRetryInterval, "first wait between telemetry init attempts, growing exponentially (env TELEMETRY_INIT_RETRY_INTERVAL)")
+	fs.StringVar(&c.TraceSampler, "trace-sampler", c.TraceSampler, "head sampler: always_on, always_off, traceidratio, parentbased_always_on, parentbased_always_off or parentbased_traceidratio (env OTEL_TRACES_SAMPLER)")
+	fs.StringVar(&c.TraceSamplerArg, "trace-sampler-arg", c.TraceSamplerArg, "sampling ratio for the traceidratio samplers (env OTEL_TRACES_SAMPLER_ARG)")
+	fs.Float64Var(&c.SampleRatio, "sample-ratio", c.SampleRatio, "share (0.0-1.0) of new traces to record; below 1.0 selects a parent-based ratio sampler and excludes -trace-sampler and -trace-sampler-arg (env TRACE_SAMPLE_RATIO)")
+	fs.Func("trace-route-sample-ratios", "comma-separated route=ratio sampling overrides, e.g. /work=1.0,/health=0.0 (env TRACE_ROUTE_SAMPLE_RATIOS)", func(v string) error {
+		ratios, err := parseRouteRatios(v)
+		if err != nil {
+			return err
+		}
+		c.TraceRouteSampleRatios = ratios
+		return nil
+	})
+}
+
+// Validate reports the first invalid setting in c.
+func (c *Config) Validate() error {
+	if err := errors.Join(c.errs...); err != nil {
+		return err
+	}
+	if c.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+			return fmt.Errorf("invalid listen address %q: must be host:port, such as 127.0.0.1:8080 or [::]:8080: %w", c.Addr, err)
+		}
+	}
+	switch c.ListenNetwork {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("invalid listen network %q: must be tcp, tcp4 or tcp6", c.ListenNetwork)
+	}
+	if c.ListenRetries < 0 {
+		return fmt.Errorf("invalid listen retries %d: must not be negative", c.ListenRetries)
+	}
+	if c.ListenRetryBackoff < 0 {
+		return fmt.Errorf("invalid listen retry backoff %s: must not be negative", c.ListenRetryBackoff)
+	}
+	switch c.TrailingSlash {
+	case "strip", "redirect", "strict":
+	default:
+		return fmt.Errorf("invalid trailing slash mode %q: must be strip, redirect or strict", c.TrailingSlash)
+	}
+	if c.RuntimeMetricsInterval < 0 {
+		return fmt.Errorf("invalid runtime metrics interval %s: must not be negative", c.RuntimeMetricsInterval)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown timeout %s: must be positive", c.ShutdownTimeout)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("invalid TLS configuration: certificate and key files must be set together")
+	}
+	if _, err := tlsVersion(c.TLSMinVersion); err != nil {
+		return err
+	}
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", c.LogFormat)
+	}
+	switch c.SpanProcessor {
+	case "batch", "simple":
+	default:
+		return fmt.Errorf("invalid span processor %q: must be batch or simple", c.SpanProcessor)
+	}
+	switch c.RedactionMode {
+	case "remove", "hash":
+	default:
+		return fmt.Errorf("invalid redaction mode %q: must be remove or hash", c.RedactionMode)
+	}
+	if c.MinWorkLatency < 0 || c.MinWorkLatency > c.MaxWorkLatency {
+		return fmt.Errorf("invalid work latency range: min %s must be between 0 and max %s", c.MinWorkLatency, c.MaxWorkLatency)
+	}
+	if c.WorkDeadline <= 0 {
+		return fmt.Errorf("invalid work deadline %s: must be positive", c.WorkDeadline)
+	}
+	if _, err := newPropagator(c.OutboundPropagator); err != nil {
+		return err
+	}
+	if c.DownstreamMaxConcurrency < 0 {
+		return fmt.Errorf("invalid downstream max concurrency %d: must not be negative", c.DownstreamMaxConcurrency)
+	}
+	if c.DownstreamRetries < 0 {
+		return fmt.Errorf("invalid downstream retries %d: must not be negative", c.DownstreamRetries)
+	}
+	if c.DownstreamRetryBackoff < 0 {
+		return fmt.Errorf("invalid downstream retry backoff %s: must not be negative", c.DownstreamRetryBackoff)
+	}
+	switch c.RetryTelemetryMode {
+	case "events", "spans":
+	default:
+		return fmt.Errorf("invalid retry telemetry mode %q: must be events or spans", c.RetryTelemetryMode)
+	}
+	if c.BatchDeadline <= 0 {
+		return fmt.Errorf("invalid batch deadline %s: must be positive", c.BatchDeadline)
+	}
+	if len(c.WorkTypes) == 0 {
+		return errors.New("invalid work types: at least one is required")
+	}
+	for _, name := range c.FeatureFlags {
+		if err := validateFeatureFlag(name); err != nil {
+			return err
+		}
+	}
+	if c.TenantMetricKey != "" && len(c.MetricTenants) == 0 {
+		return fmt.Errorf("invalid tenant metric key %q: requires metric tenants to bound its values", c.TenantMetricKey)
+	}
+	if err := validateErrorRate(c.ErrorRate); err != nil {
+		return err
+	}
+	if math.IsNaN(c.NestedErrorRate) || c.NestedErrorRate < 0 || c.NestedErrorRate > 1 {
+		return fmt.Errorf("invalid nested error rate %v: must be between 0.0 and 1.0", c.NestedErrorRate)
+	}
+	if math.IsNaN(c.ThrottleRate) || c.ThrottleRate < 0 || c.ThrottleRate > 1 {
+		return fmt.Errorf("invalid throttle rate %v: must be between 0.0 and 1.0", c.ThrottleRate)
+	}
+	if c.ThrottleRetryAfter <= 0 {
+		return fmt.Errorf("invalid throttle retry after %s: must be positive", c.ThrottleRetryAfter)
+	}
+	if err := validateBuckets(c.DurationBuckets); err != nil {
+		return err
+	}
+	if c.DurationQuantileWindow < 0 {
+		return fmt.Errorf("invalid duration quantile window %d: must not be negative", c.DurationQuantileWindow)
+	}
+	if c.CardinalityReportInterval < 0 {
+		return fmt.Errorf("invalid cardinality report interval %s: must not be negative", c.CardinalityReportInterval)
+	}
+	if c.MaxMemSpikeMB < 1 {
+		return fmt.Errorf("invalid max memspike %d MB: must be positive", c.MaxMemSpikeMB)
+	}
+	switch c.MetricPauseMode {
+	case "drop", "buffer":
+	default:
+		return fmt.Errorf("invalid metric pause mode %q: must be drop or buffer", c.MetricPauseMode)
+	}
+	if c.MaxSpansPerTrace < 0 {
+		return fmt.Errorf("invalid max spans per trace %d: must not be negative", c.MaxSpansPerTrace)
+	}
+	if c.MaxAttributeValueLength < 0 {
+		return fmt.Errorf("invalid max attribute value length %d: must not be negative", c.MaxAttributeValueLength)
+	}
+	if c.ForceSampleRequestBytes < 0 {
+		return fmt.Errorf("invalid force sample request bytes %d: must not be negative", c.ForceSampleRequestBytes)
+	}
+	if c.ServiceName == "" {
+		return errors.New("invalid service name: must not be empty")
+	}
+	for _, endpoint := range []string{c.TraceEndpoint, c.MetricEndpoint, c.LogEndpoint} {
+		if endpoint == "" {
+			continue
+		}
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", endpoint)
+		}
+	}
+	for _, protocol := range []string{c.OTLPProtocol, c.OTLPTraceProtocol, c.OTLPMetricProtocol, c.OTLPLogProtocol} {
+		switch protocol {
+		case "", "http", "http/protobuf", "grpc":
+		default:
+			return fmt.Errorf("invalid OTLP protocol %q: must be http or grpc", protocol)
+		}
+	}
+	for _, path := range []string{c.OTLPTraceURLPath, c.OTLPMetricURLPath} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid OTLP URL path %q: must start with /", path)
+		}
+	}
+	switch c.TelemetryFailureMode {
+	case "exit", "degraded":
+	default:
+		return fmt.Errorf("invalid telemetry failure mode %q: must be exit or degraded", c.TelemetryFailureMode)
+	}
+	if c.TelemetryInitTimeout <= 0 {
+		return fmt.Errorf("invalid telemetry init timeout %s: must be positive", c.TelemetryInitTimeout)
+	}
+	if c.TelemetryInitMaxElapsed < 0 {
+		return fmt.Errorf("invalid telemetry init max elapsed %s: must not be negative", c.TelemetryInitMaxElapsed)
+	}
+	if c.TelemetryInitRetryInterval <= 0 {
+		return fmt.Errorf("invalid telemetry init retry interval %s: must be positive", c.TelemetryInitRetryInterval)
+	}
+	if math.IsNaN(c.SampleRatio) || c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("invalid sample ratio %v: must be between 0.0 and 1.0", c.SampleRatio)
+	}
+	if c.SampleRatio < 1 && (c.TraceSampler != defaultTraceSampler || c.TraceSamplerArg != "") {
+		return fmt.Errorf("invalid sample ratio %v: cannot be combined with trace sampler %q; use parentbased_traceidratio and its argument instead", c.SampleRatio, c.TraceSampler)
+	}
+	if _, err := newSampler(c); err != nil {
+		return err
+	}
+	return nil
+}
+
+// redacted replaces secret values in the startup summary.
+const redacted = "[REDACTED]"
+
+// redactURL replaces the userinfo of URL v, which may hold credentials,
+// with redacted.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	u.User = nil
+	return u.Scheme + "://" + redacted + "@" + strings.TrimPrefix(u.String(), u.Scheme+"://")
+}
+
+// Attributes summarizes the effective configuration as span attributes,
+// with secrets redacted, for the startup span.
+func (c *Config) Attributes() []attribute.KeyValue {
+	secret := func(v string) string {
+		if v == "" {
+			return ""
+		}
+		return redacted
+	}
+	return []attribute.KeyValue{
+		attribute.String("config.service_name", c.ServiceName),
+		attribute.String("config.service_version", c.ServiceVersion),
+		attribute.String("config.environment", c.Environment),
+		attribute.String("config.release_id", c.ReleaseID),
+		attribute.String("config.global_attributes", (*attributeList)(&c.GlobalAttributes).String()),
+		attribute.String("config.error_counter_attributes", (*attributeList)(&c.ErrorCounterAttributes).String()),
+		attribute.String("config.port", c.Port),
+		attribute.String("config.addr", c.listenAddr()),
+		attribute.String("config.listen_network", c.ListenNetwork),
+		attribute.Int("config.listen_retries", c.ListenRetries),
+		attribute.String("config.listen_retry_backoff", c.ListenRetryBackoff.String()),
+		attribute.String("config.trailing_slash", c.TrailingSlash),
+		attribute.String("config.route_methods", formatRouteMethods(c.RouteMethods)),
+		attribute.String("config.shutdown_timeout", c.ShutdownTimeout.String()),
+		attribute.String("config.tls_cert_file", c.TLSCertFile),
+		attribute.String("config.tls_key_file", c.TLSKeyFile),
+		attribute.String("config.tls_min_version", c.TLSMinVersion),
+		attribute.String("config.header_attributes", formatHeaderAttributes(c.HeaderAttributes)),
+		attribute.String("config.span_processor", c.SpanProcessor),
+		attribute.StringSlice("config.sensitive_attribute_keys", c.SensitiveAttributeKeys),
+		attribute.String("config.redaction_mode", c.RedactionMode),
+		attribute.String("config.min_work_latency", c.MinWorkLatency.String()),
+		attribute.String("config.max_work_latency", c.MaxWorkLatency.String()),
+		attribute.String("config.work_deadline", c.WorkDeadline.String()),
+		attribute.Bool("config.coalesce_work", c.CoalesceWork),
+		attribute.String("config.downstream_url", redactURL(c.DownstreamURL)),
+		attribute.String("config.outbound_propagator", c.OutboundPropagator),
+		attribute.Int("config.downstream_max_concurrency", c.DownstreamMaxConcurrency),
+		attribute.Int("config.downstream_retries", c.DownstreamRetries),
+		attribute.String("config.downstream_retry_backoff", c.DownstreamRetryBackoff.String()),
+		attribute.String("config.retry_telemetry_mode", c.RetryTelemetryMode),
+		attribute.String("config.batch_deadline", c.BatchDeadline.String()),
+		attribute.StringSlice("config.work_types", c.WorkTypes),
+		attribute.StringSlice("config.experiment_variants", c.ExperimentVariants),
+		attribute.String("config.tenant_metric_key", c.TenantMetricKey),
+		attribute.StringSlice("config.metric_tenants", c.MetricTenants),
+		attribute.Float64("config.error_rate", c.ErrorRate),
+		attribute.Float64("config.nested_error_rate", c.NestedErrorRate),
+		attribute.String("config.error_rate_file", c.ErrorRateFile),
+		attribute.StringSlice("config.feature_flags", c.FeatureFlags),
+		attribute.Float64("config.throttle_rate", c.ThrottleRate),
+		attribute.String("config.throttle_retry_after", c.ThrottleRetryAfter.String()),
+		attribute.StringSlice("config.histogram_disabled_endpoints", c.HistogramDisabledEndpoints),
+		attribute.StringSlice("config.access_log_disabled_endpoints", c.AccessLogDisabledEndpoints),
+		attribute.String("config.access_log_sampling", formatAccessLogSampling(c.AccessLogSampling)),
+		attribute.String("config.log_format", c.LogFormat),
+		attribute.Float64Slice("config.duration_buckets", c.DurationBuckets),
+		attribute.Int("config.duration_quantile_window", c.DurationQuantileWindow),
+		attribute.String("config.cardinality_report_interval", c.CardinalityReportInterval.String()),
+		attribute.String("config.admin_token", secret(c.AdminToken)),
+		attribute.Int("config.max_memspike_mb", c.MaxMemSpikeMB),
+		attribute.String("config.metric_pause_mode", c.MetricPauseMode),
+		attribute.Int("config.max_spans_per_trace", c.MaxSpansPerTrace),
+		attribute.Int("config.max_attribute_value_length", c.MaxAttributeValueLength),
+		attribute.Bool("config.drop_healthy_spans", c.DropHealthySpans),
+		attribute.Bool("config.record_goroutines", c.RecordGoroutines),
+		attribute.Bool("config.capture_traffic_source", c.CaptureTrafficSource),
+		attribute.Bool("config.gc_pause_events", c.GCPauseEvents),
+		attribute.String("config.runtime_metrics_interval", c.RuntimeMetricsInterval.String()),
+		attribute.String("config.trace_endpoint", redactURL(c.TraceEndpoint)),
+		attribute.String("config.metric_endpoint", redactURL(c.MetricEndpoint)),
+		attribute.String("config.log_endpoint", redactURL(c.LogEndpoint)),
+		attribute.Bool("config.insecure", c.Insecure),
+		attribute.Bool("config.prometheus_enabled", c.PrometheusEnabled),
+		attribute.Bool("config.sdk_self_observability", c.SDKSelfObservability),
+		attribute.Bool("config.require_gauges", c.RequireGauges),
+		attribute.String("config.otlp_trace_protocol", c.traceProtocol()),
+		attribute.String("config.otlp_metric_protocol", c.metricProtocol()),
+		attribute.String("config.otlp_log_protocol", c.logProtocol()),
+		attribute.String("config.otlp_trace_url_path", c.OTLPTraceURLPath),
+		attribute.String("config.otlp_metric_url_path", c.OTLPMetricURLPath),
+		attribute.String("config.telemetry_failure_mode", c.TelemetryFailureMode),
+		attribute.String("config.telemetry_init_timeout", c.TelemetryInitTimeout.String()),
+		attribute.String("config.telemetry_init_max_elapsed", c.TelemetryInitMaxElapsed.String()),
+		attribute.String("config.telemetry_init_retry_interval", c.TelemetryInitRetryInterval.String()),
+		attribute.String("config.trace_sampler", c.TraceSampler),
+		attribute.String("config.trace_sampler_arg", c.TraceSamplerArg),
+		attribute.Float64("config.sample_ratio", c.SampleRatio),
+		attribute.String("config.trace_route_sample_ratios", formatRouteRatios(c.TraceRouteSampleRatios)),
+		attribute.Int64("config.force_sample_request_bytes", c.ForceSampleRequestBytes),
+		attribute.Bool("config.record_sampling_source", c.RecordSamplingSource),
+	}
+}
+
+// listenAddr returns the address the server listens on: Addr, or Port on
+// every interface.
+func (c *Config) listenAddr() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	return net.JoinHostPort("", c.Port)
+}
+
+// accessLogEnabled reports whether requests to endpoint are access logged.
+func (c *Config) accessLogEnabled(endpoint string) bool {
+	return !slices.Contains(c.AccessLogDisabledEndpoints, endpoint)
+}
+
+// histogramEnabled reports whether request durations are recorded for endpoint.
+func (c *Config) histogramEnabled(endpoint string) bool {
+	return !slices.Contains(c.HistogramDisabledEndpoints, endpoint)
+}
+
+// stringList is a flag.Value holding a comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = splitList(v)
+	return nil
+}
+
+// splitList splits a comma-separated list, trimming blanks and dropping
+// empty entries.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// attributeList is a flag.Value holding comma-separated key=value attributes.
+type attributeList []attribute.KeyValue
+
+func (l *attributeList) String() string {
+	if l == nil {
+		return ""
+	}
+	pairs := make([]string, len(*l))
+	for i, attr := range *l {
+		pairs[i] = string(attr.Key) + "=" + attr.Value.Emit()
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l *attributeList) Set(v string) error {
+	attrs, err := parseAttributes(v)
+	if err != nil {
+		return err
+	}
+	*l = attrs
+	return nil
+}
+
+// parseAttributes parses comma-separated key=value pairs into string
+// attributes.
+func parseAttributes(v string) ([]attribute.KeyValue, error) {
+	var attrs []attribute.KeyValue
+	for _, pair := range splitList(v) {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid attribute %q: must be key=value", pair)
+		}
+		attrs = append(attrs, attribute.String(key, strings.TrimSpace(value)))
+	}
+	return attrs, nil
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// tlsVersion returns the crypto/tls constant for a TLSMinVersion setting.
+// Versions before 1.2 are rejected.
+func tlsVersion(v string) (uint16, error) {
+	switch v {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS min version %q: must be 1.2 or 1.3", v)
+	}
+}
+
+// tlsConfig returns the TLS settings shared by the server and the
+// exporters. c must be valid.
+func (c *Config) tlsConfig() *tls.Config {
+	v, _ := tlsVersion(c.TLSMinVersion)
+	return &tls.Config{MinVersion: v}
+}
+
+// checkCertificate loads the TLSCertFile and TLSKeyFile pair, if set, so a
+// missing or mismatched pair is reported before the listener binds.
+func (c *Config) checkCertificate() error {
+	if c.TLSCertFile == "" {
+		return nil
+	}
+	if _, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile); err != nil {
+		return fmt.Errorf("invalid TLS certificate %s and key %s: %w", c.TLSCertFile, c.TLSKeyFile, err)
+	}
+	return nil
+}
+
+// traceProtocol returns the OTLP transport for spans.
+func (c *Config) traceProtocol() string {
+	if c.OTLPTraceProtocol != "" {
+		return c.OTLPTraceProtocol
+	}
+	return c.OTLPProtocol
+}
+
+// metricProtocol returns the OTLP transport for metrics.
+func (c *Config) metricProtocol() string {
+	if c.OTLPMetricProtocol != "" {
+		return c.OTLPMetricProtocol
+	}
+	return c.OTLPProtocol
+}
+
+// logProtocol returns the OTLP transport for logs.
+func (c *Config) logProtocol() string {
+	if c.OTLPLogProtocol != "" {
+		return c.OTLPLogProtocol
+	}
+	return c.OTLPProtocol
+}
+
+// otlpEndpoint returns the OTLP endpoint in the signal-specific environment
+// variable signalKey, falling back to OTEL_EXPORTER_OTLP_ENDPOINT with the
+// signal's default path appended, as the OTLP exporters do.
+func otlpEndpoint(signalKey, path string) string {
+	if v := os.Getenv(signalKey); v != "" {
+		return v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		return strings.TrimSuffix(v, "/") + path
+	}
+	return ""
+}
+
+// envAttributes parses the key=value list in environment variable key,
+// recording a parse failure on c.
+func (c *Config) envAttributes(key string) []attribute.KeyValue {
+	attrs, err := parseAttributes(os.Getenv(key))
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+	}
+	return attrs
+}
+
+// envInt parses the integer in environment variable key, recording a parse
+// failure on c and returning def.
+func (c *Config) envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s %q: %w", key, v, err))
+		return def
+	}
+	return n
+}
+
+// envBool parses the boolean in environment variable key, recording a parse
+// failure on c and returning def.
+func (c *Config) envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s %q: %w", key, v, err))
+		return def
+	}
+	return b
+}
+
+// envFloat parses the float in environment variable key, recording a parse
+// failure on c and returning def.
+func (c *Config) envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s %q: %w", key, v, err))
+		return def
+	}
+	return f
+}
+
+// envAccessLogSampling parses the endpoint=N list in environment variable
+// key, recording a parse failure on c.
+func (c *Config) envAccessLogSampling(key string) map[string]int {
+	rates, err := parseAccessLogSampling(os.Getenv(key))
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+	}
+	return rates
+}
+
+// envRouteRatios parses the route=ratio list in environment variable key,
+// recording a parse failure on c.
+func (c *Config) envRouteRatios(key string) map[string]float64 {
+	ratios, err := parseRouteRatios(os.Getenv(key))
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+	}
+	return ratios
+}
+
+// envRouteMethods parses the route=METHOD|METHOD list in environment
+// variable key, or def when it is unset, recording a parse failure on c.
+func (c *Config) envRouteMethods(key, def string) map[string][]string {
+	routes, err := parseRouteMethods(envOrDefault(key, def))
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+		routes, _ = parseRouteMethods(def)
+	}
+	return routes
+}
+
+// defaultDurationBuckets spans typical web latencies from 5ms to 10s.
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// parseBuckets parses comma-separated histogram bucket boundaries.
+func parseBuckets(v string) ([]float64, error) {
+	var buckets []float64
+	for _, item := range splitList(v) {
+		b, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket boundary %q: %w", item, err)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// validateBuckets reports boundaries that are not finite and strictly
+// increasing.
+func validateBuckets(buckets []float64) error {
+	for i, b := range buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("invalid duration buckets %v: boundaries must be finite", buckets)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return fmt.Errorf("invalid duration buckets %v: boundaries must be strictly increasing", buckets)
+		}
+	}
+	return nil
+}
+
+// envBuckets parses the bucket boundaries in environment variable key,
+// recording a parse failure on c and returning def when it is unset.
+func (c *Config) envBuckets(key string, def []float64) []float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return slices.Clone(def)
+	}
+	buckets, err := parseBuckets(v)
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+		return slices.Clone(def)
+	}
+	return buckets
+}
+
+// envHeaderAttributes parses the header mappings in environment variable
+// key, recording a parse failure on c.
+func (c *Config) envHeaderAttributes(key string) []headerAttribute {
+	mappings, err := parseHeaderAttributes(os.Getenv(key))
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s: %w", key, err))
+	}
+	return mappings
+}
+
+// formatRouteRatios renders ratios in the route=ratio form parseRouteRatios
+// accepts, sorted by route.
+func formatRouteRatios(ratios map[string]float64) string {
+	pairs := make([]string, 0, len(ratios))
+	for route, ratio := range ratios {
+		pairs = append(pairs, route+"="+strconv.FormatFloat(ratio, 'f', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// envDuration parses the duration in environment variable key, recording a
+// parse failure on c and returning def.
+func (c *Config) envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		c.errs = append(c.errs, fmt.Errorf("invalid %s %q: %w", key, v, err))
+		return def
+	}
+	return d
+}
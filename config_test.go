@@ -0,0 +1,229 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidateListenNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		wantErr bool
+	}{
+		{name: "dual-stack", network: "tcp"},
+		{name: "ipv4", network: "tcp4"},
+		{name: "ipv6", network: "tcp6"},
+		{name: "unknown", network: "udp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.ListenNetwork = tt.network
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		wantErr bool
+	}{
+		{name: "unset", addr: ""},
+		{name: "loopback", addr: "127.0.0.1:8080"},
+		{name: "ipv6 unspecified", addr: "[::]:8080"},
+		{name: "any host", addr: ":9090"},
+		{name: "missing port", addr: "127.0.0.1", wantErr: true},
+		{name: "unbracketed ipv6", addr: "::1:8080", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.Addr = tt.addr
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateWorkLatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     time.Duration
+		max     time.Duration
+		wantErr bool
+	}{
+		{name: "defaults", min: 0, max: 500 * time.Millisecond},
+		{name: "fixed latency", min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "min above max", min: time.Second, max: 500 * time.Millisecond, wantErr: true},
+		{name: "negative min", min: -time.Millisecond, max: 500 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.MinWorkLatency = tt.min
+			cfg.MaxWorkLatency = tt.max
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateThrottleRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		wantErr bool
+	}{
+		{name: "off", rate: 0},
+		{name: "always", rate: 1},
+		{name: "negative", rate: -0.1, wantErr: true},
+		{name: "above one", rate: 1.5, wantErr: true},
+		{name: "not a number", rate: math.NaN(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.ThrottleRate = tt.rate
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateSampleRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler string
+		arg     string
+		ratio   float64
+		wantErr bool
+	}{
+		{name: "ratio alone", sampler: defaultTraceSampler, ratio: 0.1},
+		{name: "sampler alone", sampler: "parentbased_traceidratio", arg: "0.1", ratio: 1},
+		{name: "ratio with another sampler", sampler: "always_on", ratio: 0.1, wantErr: true},
+		{name: "ratio with sampler arg", sampler: defaultTraceSampler, arg: "0.5", ratio: 0.1, wantErr: true},
+		{name: "ratio not a number", sampler: defaultTraceSampler, ratio: math.NaN(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.TraceSampler = tt.sampler
+			cfg.TraceSamplerArg = tt.arg
+			cfg.SampleRatio = tt.ratio
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateFeatureFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "at limit", flags: []string{"new-cache", strings.Repeat("x", maxFeatureFlagNameLength)}},
+		{name: "over limit", flags: []string{"new-cache", strings.Repeat("x", maxFeatureFlagNameLength+1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.FeatureFlags = tt.flags
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromEnvInvalidDuration(t *testing.T) {
+	t.Setenv("MIN_WORK_LATENCY", "soon")
+
+	if err := LoadConfigFromEnv().Validate(); err == nil {
+		t.Error("Expected an error for an unparsable MIN_WORK_LATENCY")
+	}
+}
+
+func TestLoadConfigFromEnvInvalidAttributes(t *testing.T) {
+	t.Setenv("GLOBAL_ATTRIBUTES", "cluster.name")
+
+	if err := LoadConfigFromEnv().Validate(); err == nil {
+		t.Error("Expected an error for a GLOBAL_ATTRIBUTES entry without a value")
+	}
+}
+
+func TestLoadConfigFromEnvOTLPEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantTrace  string
+		wantMetric string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:       "generic endpoint",
+			env:        map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"},
+			wantTrace:  "http://collector:4318/v1/traces",
+			wantMetric: "http://collector:4318/v1/metrics",
+		},
+		{
+			name: "signal endpoints win",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":         "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT":  "http://traces:4318/ingest",
+				"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT": "http://metrics:4318/ingest",
+			},
+			wantTrace:  "http://traces:4318/ingest",
+			wantMetric: "http://metrics:4318/ingest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"} {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg := LoadConfigFromEnv()
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Invalid configuration: %v", err)
+			}
+			if cfg.TraceEndpoint != tt.wantTrace {
+				t.Errorf("Expected trace endpoint %q, got %q", tt.wantTrace, cfg.TraceEndpoint)
+			}
+			if cfg.MetricEndpoint != tt.wantMetric {
+				t.Errorf("Expected metric endpoint %q, got %q", tt.wantMetric, cfg.MetricEndpoint)
+			}
+		})
+	}
+}
+
+func TestDurationBucketsInvalid(t *testing.T) {
+	for _, v := range []string{"0.1,0.05", "0.1,0.1", "fast"} {
+		t.Run(v, func(t *testing.T) {
+			t.Setenv("DURATION_BUCKETS", v)
+			if err := LoadConfigFromEnv().Validate(); err == nil {
+				t.Errorf("Expected DURATION_BUCKETS=%q to be rejected", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+)
+
+// degradedMux serves only /health, reporting 503 with the reason telemetry
+// failed, so orchestrators see the failure instead of a crash loop.
+func degradedMux(initErr error) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "degraded",
+			"reason": "telemetry_failed",
+			"error":  initErr.Error(),
+		})
+	})
+	return mux
+}
+
+// serveDegraded runs the server in degraded mode after initTelemetry failed
+// with initErr, until SIGINT or SIGTERM.
+func serveDegraded(cfg *Config, initErr error) {
+	ln, err := listen(cfg)
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+	srv := &http.Server{Handler: degradedMux(initErr)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	slog.Warn("Serving degraded /health only", "addr", ln.Addr().String())
+	if err := serve(cfg, srv, ln); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDegradedModeAfterTelemetryFailure(t *testing.T) {
+	cfg := LoadConfigFromEnv()
+	cfg.TelemetryFailureMode = "degraded"
+	cfg.TelemetryInitTimeout = time.Nanosecond
+	withConfig(t, func(c *Config) { *c = *cfg })
+
+	_, initErr := initTelemetry(cfg)
+	if initErr == nil {
+		t.Fatal("Expected telemetry init to fail")
+	}
+
+	srv := httptest.NewServer(degradedMux(initErr))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("Failed to GET /health: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["reason"] != "telemetry_failed" {
+		t.Errorf("Expected reason telemetry_failed, got %q", body["reason"])
+	}
+	if !strings.Contains(body["error"], "timed out") {
+		t.Errorf("Expected the init error in the response, got %q", body["error"])
+	}
+
+	// Nothing but /health is served
+	work, err := http.Get(srv.URL + "/work")
+	if err != nil {
+		t.Fatalf("Failed to GET /work: %v", err)
+	}
+	work.Body.Close()
+	if work.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected /work to be unavailable, got %d", work.StatusCode)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newPropagator returns the propagator for the trace context format named
+// by format, "tracecontext" for W3C traceparent headers or "b3" for B3
+// headers, composited with W3C baggage so values such as tenant.id reach
+// the downstream whichever format is used.
+func newPropagator(format string) (propagation.TextMapPropagator, error) {
+	switch format {
+	case "tracecontext":
+		return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}), nil
+	case "b3":
+		return propagation.NewCompositeTextMapPropagator(b3.New(), propagation.Baggage{}), nil
+	default:
+		return nil, fmt.Errorf("invalid propagator %q: must be tracecontext or b3", format)
+	}
+}
+
+// acquireDownstreamSlot waits for one of the Config.DownstreamMaxConcurrency
+// slots, recording the wait in downstreamWait, and returns the func that
+// frees it. It gives up when ctx is done.
+func (a *App) acquireDownstreamSlot(ctx context.Context) (release func(), err error) {
+	if a.downstreamSlots == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	select {
+	case a.downstreamSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	wait := time.Since(start)
+	a.downstreamWait.Record(ctx, wait.Seconds())
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("downstream.wait_ms", wait.Milliseconds()))
+	return func() { <-a.downstreamSlots }, nil
+}
+
+// callDownstream makes the simulated downstream call to url in a client
+// span, injecting the trace context in Config.OutboundPropagator's format
+// independently of the inbound format.
+func (a *App) callDownstream(ctx context.Context, url string) error {
+	ctx, span := a.tracer.Start(ctx, "downstream_call", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	release, err := a.acquireDownstreamSlot(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "no downstream slot")
+		return err
+	}
+	defer release()
+
+	propagator, err := newPropagator(appConfig.OutboundPropagator)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid downstream request")
+		return err
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "downstream call failed")
+		return err
+	}
+	resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+		return fmt.Errorf("downstream returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestCallDownstreamOutboundPropagator(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name        string
+		propagator  string
+		wantHeader  string
+		wantTraceID string
+		wantAbsent  string
+	}{
+		{
+			name:        "b3 outbound",
+			propagator:  "b3",
+			wantHeader:  "B3",
+			wantTraceID: traceID,
+			wantAbsent:  "Traceparent",
+		},
+		{
+			name:       "w3c outbound",
+			propagator: "tracecontext",
+			wantHeader: "Traceparent",
+			wantAbsent: "B3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+
+			var got http.Header
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+			}))
+			defer downstream.Close()
+
+			withConfig(t, func(c *Config) {
+				c.MaxWorkLatency = time.Millisecond
+				c.DownstreamURL = downstream.URL
+				c.OutboundPropagator = tt.propagator
+			})
+
+			// The inbound request always carries W3C trace context and baggage
+			req := httptest.NewRequest(http.MethodGet, "/work", nil)
+			req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			req.Header.Set("baggage", "tenant.id=acme")
+			app.serveWork(httptest.NewRecorder(), req)
+
+			if got == nil {
+				t.Fatal("Expected the downstream to be called")
+			}
+			if got.Get(tt.wantHeader) == "" {
+				t.Errorf("Expected header %s, got %v", tt.wantHeader, got)
+			}
+			if tt.wantTraceID != "" && !strings.HasPrefix(got.Get(tt.wantHeader), tt.wantTraceID+"-") {
+				t.Errorf("Expected %s to carry trace ID %s, got %q", tt.wantHeader, tt.wantTraceID, got.Get(tt.wantHeader))
+			}
+			if v := got.Get(tt.wantAbsent); v != "" {
+				t.Errorf("Expected no %s header, got %q", tt.wantAbsent, v)
+			}
+			if v := got.Get("Baggage"); v != "tenant.id=acme" {
+				t.Errorf("Expected the inbound baggage to be forwarded, got %q", v)
+			}
+		})
+	}
+}
+
+func TestCallDownstreamConcurrencyCap(t *testing.T) {
+	withConfig(t, func(c *Config) { c.DownstreamMaxConcurrency = 1 })
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	var inFlight, maxInFlight atomic.Int32
+	arrived := make(chan struct{}, 2)
+	proceed := make(chan struct{})
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		arrived <- struct{}{}
+		<-proceed
+	}))
+	defer downstream.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := app.callDownstream(context.Background(), downstream.URL); err != nil {
+				t.Errorf("Downstream call failed: %v", err)
+			}
+		}()
+	}
+
+	// Hold the first call in the downstream so the second has to wait
+	<-arrived
+	select {
+	case <-arrived:
+		t.Error("Expected the second call to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(proceed)
+	wg.Wait()
+
+	if n := maxInFlight.Load(); n != 1 {
+		t.Errorf("Expected at most 1 downstream call in flight, got %d", n)
+	}
+	m, ok := findMetric(collectMetrics(t), "downstream_wait_duration_seconds")
+	if !ok {
+		t.Fatal("Expected downstream_wait_duration_seconds to be collected")
+	}
+	points := m.Data.(metricdata.Histogram[float64]).DataPoints
+	if len(points) != 1 || points[0].Count != 2 {
+		t.Fatalf("Expected 2 waits recorded, got %+v", points)
+	}
+	if max, ok := points[0].Max.Value(); !ok || max < 0.05 {
+		t.Errorf("Expected the second call to wait at least 50ms, longest wait %vs", max)
+	}
+}
+
+func TestWorkDeadlineBoundsDownstream(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	release := make(chan struct{})
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer downstream.Close()
+	defer close(release)
+
+	withConfig(t, func(c *Config) {
+		c.MinWorkLatency = 0
+		c.MaxWorkLatency = time.Millisecond
+		c.WorkDeadline = 50 * time.Millisecond
+		c.DownstreamURL = downstream.URL
+		c.DownstreamRetries = 3
+		c.DownstreamRetryBackoff = 10 * time.Millisecond
+	})
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	app.serveWork(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the work deadline to cut the downstream call short, took %s", elapsed)
+	}
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+}
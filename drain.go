@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// drainTracker counts in-flight requests and whether the server is draining
+// them for shutdown, so operators can watch a drain progress.
+type drainTracker struct {
+	inFlight atomic.Int64
+	draining atomic.Bool
+}
+
+// track wraps next so its requests are counted while in flight.
+func (d *drainTracker) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// state reports whether a drain is in progress and how many requests it is
+// still waiting on; outside a drain no requests are remaining.
+func (d *drainTracker) state() (draining bool, remaining int64) {
+	if !d.draining.Load() {
+		return false, 0
+	}
+	return true, d.inFlight.Load()
+}
+
+// shutdownServer stops srv accepting connections and waits until its
+// in-flight requests finish or ctx is done, marking d as draining meanwhile.
+func shutdownServer(ctx context.Context, srv *http.Server, d *drainTracker) error {
+	d.draining.Store(true)
+	defer d.draining.Store(false)
+	return srv.Shutdown(ctx)
+}
+
+// registerDrainGauges reports d through the shutdown_in_progress and
+// shutdown_remaining_requests gauges.
+func registerDrainGauges(m metric.Meter, d *drainTracker) error {
+	inProgress, err := m.Int64ObservableGauge(
+		"shutdown_in_progress",
+		metric.WithDescription("1 while the server is draining requests for shutdown, otherwise 0"),
+	)
+	if err != nil {
+		return err
+	}
+	remaining, err := m.Int64ObservableGauge(
+		"shutdown_remaining_requests",
+		metric.WithDescription("Number of in-flight requests the shutdown drain is waiting on"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		draining, n := d.state()
+		var v int64
+		if draining {
+			v = 1
+		}
+		o.ObserveInt64(inProgress, v)
+		o.ObserveInt64(remaining, n)
+		return nil
+	}, inProgress, remaining)
+	return err
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// drainGauges returns the current shutdown_in_progress and
+// shutdown_remaining_requests values.
+func drainGauges(t *testing.T) (inProgress, remaining int64) {
+	t.Helper()
+	rm := collectMetrics(t)
+	for name, v := range map[string]*int64{
+		"shutdown_in_progress":        &inProgress,
+		"shutdown_remaining_requests": &remaining,
+	} {
+		m, ok := findMetric(rm, name)
+		if !ok {
+			t.Fatalf("Expected %s to be collected", name)
+		}
+		*v = m.Data.(metricdata.Gauge[int64]).DataPoints[0].Value
+	}
+	return inProgress, remaining
+}
+
+func TestShutdownDrainGauges(t *testing.T) {
+	if _, err := setupTestTelemetry(); err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: drain.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve(ln)
+
+	requestDone := make(chan struct{})
+	go func() {
+		defer close(requestDone)
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	if inProgress, remaining := drainGauges(t); inProgress != 0 || remaining != 0 {
+		t.Errorf("Expected gauges 0/0 before shutdown, got %d/%d", inProgress, remaining)
+	}
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- shutdownServer(context.Background(), srv, drain) }()
+
+	deadline := time.Now().Add(time.Second)
+	for !drain.draining.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if inProgress, remaining := drainGauges(t); inProgress != 1 || remaining != 1 {
+		t.Errorf("Expected gauges 1/1 while draining, got %d/%d", inProgress, remaining)
+	}
+
+	close(release)
+	<-requestDone
+	if err := <-shutdownDone; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if inProgress, remaining := drainGauges(t); inProgress != 0 || remaining != 0 {
+		t.Errorf("Expected gauges 0/0 after the drain, got %d/%d", inProgress, remaining)
+	}
+}
+
+func TestShutdownFlushesInFlightTrace(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MaxWorkLatency = 50 * time.Millisecond })
+
+	// A batcher holds spans until the provider shuts down
+	exporter := &stubSpanExporter{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Hour)))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(&stubMetricExporter{})))
+	app, err := newApp(tp, mp)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	entered := make(chan struct{})
+	srv := &http.Server{Handler: drain.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		app.serveWork(w, r)
+	}))}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve(ln)
+
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String() + "/work"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	if err := shutdownServer(context.Background(), srv, drain); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	flushTelemetry(app)
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	found := false
+	for _, span := range exporter.spans {
+		if span.Name() == "do_work" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the in-flight do_work span to be exported on shutdown, got %d spans", len(exporter.spans))
+	}
+}
+
+func TestShutdownCompletesInFlightWork(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.MinWorkLatency = 100 * time.Millisecond
+		c.MaxWorkLatency = 200 * time.Millisecond
+	})
+	errorRate.Store(0)
+	t.Cleanup(func() { errorRate.Store(appConfig.ErrorRate) })
+
+	entered := make(chan struct{})
+	srv := &http.Server{Handler: drain.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		app.serveWork(w, r)
+	}))}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve(ln)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/work")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-entered
+
+	if err := shutdownServer(context.Background(), srv, drain); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("Expected the in-flight request to finish with 200, got %d", got)
+	}
+}
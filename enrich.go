@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// enricher derives span attributes from an incoming request.
+type enricher func(r *http.Request) []attribute.KeyValue
+
+type attributeBagKey struct{}
+
+// attributeBag collects attributes contributed while a request passes through
+// the middleware chain and its handler.
+type attributeBag struct {
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+}
+
+// enrich wraps next so that each enricher's attributes are collected in the
+// request context before next runs. Once the handler chain has run,
+// flushSpanAttributes sets them, with any the chain added, on the request
+// span sorted by key, so the order enrichers are registered in does not
+// change the span.
+func enrich(next http.Handler, enrichers ...enricher) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), attributeBagKey{}, &attributeBag{}))
+		for _, e := range enrichers {
+			addSpanAttributes(r.Context(), e(r)...)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// addSpanAttributes adds attrs to the bag in ctx, reporting whether ctx has
+// one. Middlewares that are not enrichers can use it directly.
+func addSpanAttributes(ctx context.Context, attrs ...attribute.KeyValue) bool {
+	bag, ok := ctx.Value(attributeBagKey{}).(*attributeBag)
+	if !ok {
+		return false
+	}
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	bag.attrs = append(bag.attrs, attrs...)
+	return true
+}
+
+// flushSpanAttributes sets the attributes collected in ctx on span. Later
+// values for a key replace earlier ones.
+func flushSpanAttributes(ctx context.Context, span trace.Span) {
+	span.SetAttributes(bagAttributes(ctx)...)
+}
+
+// bagAttributes returns the attributes collected in ctx sorted by key.
+func bagAttributes(ctx context.Context) []attribute.KeyValue {
+	bag, ok := ctx.Value(attributeBagKey{}).(*attributeBag)
+	if !ok {
+		return nil
+	}
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	attrs := append([]attribute.KeyValue(nil), bag.attrs...)
+	sort.SliceStable(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// headerAttribute maps an inbound request header to a span attribute. When
+// allowed is non-empty, only those values are recorded.
+type headerAttribute struct {
+	header  string
+	key     attribute.Key
+	allowed []string
+}
+
+// parseHeaderAttributes parses comma-separated Header=attribute.key entries,
+// each optionally followed by :value1|value2 to allowlist values, e.g.
+// "X-Tenant=tenant.id:acme|globex,X-Region=client.region".
+func parseHeaderAttributes(v string) ([]headerAttribute, error) {
+	var mappings []headerAttribute
+	for _, entry := range splitList(v) {
+		header, rest, ok := strings.Cut(entry, "=")
+		header = strings.TrimSpace(header)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("invalid header attribute %q: must be Header=attribute.key", entry)
+		}
+		key, values, _ := strings.Cut(rest, ":")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid header attribute %q: empty attribute key", entry)
+		}
+		m := headerAttribute{header: http.CanonicalHeaderKey(header), key: attribute.Key(key)}
+		for _, value := range strings.Split(values, "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				m.allowed = append(m.allowed, value)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// formatHeaderAttributes renders mappings in the form parseHeaderAttributes
+// accepts.
+func formatHeaderAttributes(mappings []headerAttribute) string {
+	entries := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		entry := m.header + "=" + string(m.key)
+		if len(m.allowed) > 0 {
+			entry += ":" + strings.Join(m.allowed, "|")
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ",")
+}
+
+// headerEnricher records the configured request headers as span attributes,
+// skipping absent headers and values outside a mapping's allowlist.
+func headerEnricher(mappings []headerAttribute) enricher {
+	return func(r *http.Request) []attribute.KeyValue {
+		var attrs []attribute.KeyValue
+		for _, m := range mappings {
+			value := r.Header.Get(m.header)
+			if value == "" || (len(m.allowed) > 0 && !slices.Contains(m.allowed, value)) {
+				continue
+			}
+			attrs = append(attrs, m.key.String(value))
+		}
+		return attrs
+	}
+}
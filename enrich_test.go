@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestEnrichOrderIndependent(t *testing.T) {
+	tenant := func(r *http.Request) []attribute.KeyValue {
+		return []attribute.KeyValue{attribute.String("tenant.id", r.Header.Get("X-Tenant"))}
+	}
+	client := func(r *http.Request) []attribute.KeyValue {
+		return []attribute.KeyValue{attribute.String("client.name", r.Header.Get("User-Agent"))}
+	}
+
+	tests := []struct {
+		name      string
+		enrichers []enricher
+	}{
+		{name: "tenant first", enrichers: []enricher{tenant, client}},
+		{name: "client first", enrichers: []enricher{client, tenant}},
+	}
+
+	var first []attribute.KeyValue
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+
+			handler := enrich(app.withTelemetry("/enriched", "enriched", func(w http.ResponseWriter, r *http.Request) {}), tt.enrichers...)
+
+			req := httptest.NewRequest(http.MethodGet, "/enriched", nil)
+			req.Header.Set("X-Tenant", "acme")
+			req.Header.Set("User-Agent", "probe")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			span := endedSpan(t, "enriched")
+			if got, _ := spanAttribute(span, "tenant.id"); got.AsString() != "acme" {
+				t.Errorf("Expected tenant.id %q, got %q", "acme", got.AsString())
+			}
+			if got, _ := spanAttribute(span, "client.name"); got.AsString() != "probe" {
+				t.Errorf("Expected client.name %q, got %q", "probe", got.AsString())
+			}
+
+			if first == nil {
+				first = span.Attributes()
+				return
+			}
+			if !reflect.DeepEqual(first, span.Attributes()) {
+				t.Errorf("Expected attributes %v, got %v", first, span.Attributes())
+			}
+		})
+	}
+}
+
+func TestEnrichAttributesAddedByHandler(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	tenant := func(r *http.Request) []attribute.KeyValue {
+		return []attribute.KeyValue{attribute.String("tenant.id", r.Header.Get("X-Tenant"))}
+	}
+
+	handler := enrich(app.withTelemetry("/enriched", "enriched", func(w http.ResponseWriter, r *http.Request) {
+		// Known only once the request has been handled
+		addSpanAttributes(r.Context(), attribute.String("tenant.plan", "gold"))
+	}), tenant)
+
+	req := httptest.NewRequest(http.MethodGet, "/enriched", nil)
+	req.Header.Set("X-Tenant", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := endedSpan(t, "enriched")
+	if got, _ := spanAttribute(span, "tenant.id"); got.AsString() != "acme" {
+		t.Errorf("Expected tenant.id %q, got %q", "acme", got.AsString())
+	}
+	if got, _ := spanAttribute(span, "tenant.plan"); got.AsString() != "gold" {
+		t.Errorf("Expected tenant.plan %q added by the handler, got %q", "gold", got.AsString())
+	}
+}
+
+func TestAddSpanAttributesWithoutBag(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if addSpanAttributes(req.Context(), attribute.Bool("ignored", true)) {
+		t.Error("Expected no attribute bag outside enrich")
+	}
+}
+
+func TestHeaderEnricher(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapping   string
+		header    string
+		wantValue string
+		wantSet   bool
+	}{
+		{name: "mapped", mapping: "X-Tenant=tenant.id", header: "acme", wantValue: "acme", wantSet: true},
+		{name: "allowed value", mapping: "x-tenant=tenant.id:acme|globex", header: "globex", wantValue: "globex", wantSet: true},
+		{name: "value not allowed", mapping: "X-Tenant=tenant.id:acme", header: "initech", wantSet: false},
+		{name: "header absent", mapping: "X-Tenant=tenant.id", wantSet: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			mappings, err := parseHeaderAttributes(tt.mapping)
+			if err != nil {
+				t.Fatalf("Failed to parse mapping: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Tenant", tt.header)
+			}
+			enrich(http.HandlerFunc(app.serveHealth), headerEnricher(mappings)).ServeHTTP(httptest.NewRecorder(), req)
+
+			got, ok := spanAttribute(endedSpan(t, "health_check"), "tenant.id")
+			if ok != tt.wantSet {
+				t.Fatalf("Expected tenant.id set=%v, got %v", tt.wantSet, ok)
+			}
+			if ok && got.AsString() != tt.wantValue {
+				t.Errorf("Expected tenant.id %q, got %q", tt.wantValue, got.AsString())
+			}
+		})
+	}
+}
+
+func TestParseHeaderAttributesInvalid(t *testing.T) {
+	for _, v := range []string{"X-Tenant", "=tenant.id", "X-Tenant="} {
+		if _, err := parseHeaderAttributes(v); err == nil {
+			t.Errorf("Expected an error for %q", v)
+		}
+	}
+}
+
+func TestTruncateAttributeValues(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MaxAttributeValueLength = 32 })
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	long := "Mozilla/5.0 " + strings.Repeat("(compatible; bloated) ", 100)
+	handler := enrich(app.withTelemetry("/enriched", "enriched", func(w http.ResponseWriter, r *http.Request) {
+		// Set after the span started, and on a span of its own
+		addSpanAttributes(r.Context(), attribute.String("client.note", r.Header.Get("User-Agent")))
+		_, child := otel.Tracer("test").Start(r.Context(), "child")
+		child.SetAttributes(attribute.String("client.note", r.Header.Get("User-Agent")))
+		child.End()
+	}), headerEnricher([]headerAttribute{{header: "User-Agent", key: "user_agent.original"}}))
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "short", userAgent: "probe/1.0", want: "probe/1.0"},
+		{name: "at limit", userAgent: long[:32], want: long[:32]},
+		{name: "over limit", userAgent: long, want: long[:31] + "…"},
+		{name: "multibyte", userAgent: strings.Repeat("é", 40), want: strings.Repeat("é", 31) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/enriched", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, attr := range []struct {
+				span string
+				key  string
+			}{
+				{span: "enriched", key: "user_agent.original"},
+				{span: "enriched", key: "client.note"},
+				{span: "child", key: "client.note"},
+			} {
+				got, _ := spanAttribute(endedSpan(t, attr.span), attr.key)
+				if got.AsString() != tt.want {
+					t.Errorf("Expected %s %s %q, got %q", attr.span, attr.key, tt.want, got.AsString())
+				}
+				if n := utf8.RuneCountInString(got.AsString()); n > 32 {
+					t.Errorf("Expected at most 32 characters, got %d", n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// experimentVariantKey labels request spans and http_requests_total with the
+// A/B experiment variant the request was served under.
+const experimentVariantKey = attribute.Key("experiment.variant")
+
+const (
+	// experimentHeader carries the variant; it takes precedence over
+	// experimentCookie.
+	experimentHeader = "X-Experiment-Variant"
+	experimentCookie = "experiment_variant"
+
+	// otherVariant replaces variants not in Config.ExperimentVariants, so
+	// clients cannot grow the metric's cardinality.
+	otherVariant = "other"
+)
+
+type experimentVariantCtxKey struct{}
+
+// requestVariant returns the experiment variant r was sent with, from
+// experimentHeader or experimentCookie. Unknown variants are reported as
+// otherVariant. ok is false when r names no variant or no variants are
+// configured.
+func requestVariant(r *http.Request) (variant string, ok bool) {
+	if len(appConfig.ExperimentVariants) == 0 {
+		return "", false
+	}
+	variant = r.Header.Get(experimentHeader)
+	if variant == "" {
+		if c, err := r.Cookie(experimentCookie); err == nil {
+			variant = c.Value
+		}
+	}
+	if variant == "" {
+		return "", false
+	}
+	if !slices.Contains(appConfig.ExperimentVariants, variant) {
+		variant = otherVariant
+	}
+	return variant, true
+}
+
+// withExperimentVariant records variant in ctx for countRequest.
+func withExperimentVariant(ctx context.Context, variant string) context.Context {
+	return context.WithValue(ctx, experimentVariantCtxKey{}, variant)
+}
+
+// experimentVariant returns the variant stored in ctx by
+// withExperimentVariant.
+func experimentVariant(ctx context.Context) (string, bool) {
+	variant, ok := ctx.Value(experimentVariantCtxKey{}).(string)
+	return variant, ok
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestExperimentVariant(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		cookie      string
+		wantVariant string
+	}{
+		{name: "header", header: "treatment", wantVariant: "treatment"},
+		{name: "cookie", cookie: "control", wantVariant: "control"},
+		{name: "header wins over cookie", header: "treatment", cookie: "control", wantVariant: "treatment"},
+		{name: "unknown variant", header: "rogue-123", wantVariant: "other"},
+		{name: "no variant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) { c.ExperimentVariants = []string{"control", "treatment"} })
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.header != "" {
+				req.Header.Set(experimentHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: experimentCookie, Value: tt.cookie})
+			}
+			app.serveHealth(httptest.NewRecorder(), req)
+
+			got, ok := spanAttribute(endedSpan(t, "health_check"), string(experimentVariantKey))
+			if ok != (tt.wantVariant != "") || got.AsString() != tt.wantVariant {
+				t.Errorf("Expected span %s=%q, got %q (set=%v)", experimentVariantKey, tt.wantVariant, got.AsString(), ok)
+			}
+
+			rm := collectMetrics(t)
+			if tt.wantVariant == "" {
+				if n := counterValue(t, rm, "http_requests_total", attribute.String("endpoint", "/health")); n != 1 {
+					t.Errorf("Expected 1 request counted, got %d", n)
+				}
+				return
+			}
+			if n := counterValue(t, rm, "http_requests_total", experimentVariantKey.String(tt.wantVariant)); n != 1 {
+				t.Errorf("Expected 1 request labelled %s=%q, got %d", experimentVariantKey, tt.wantVariant, n)
+			}
+		})
+	}
+}
+
+func TestExperimentVariantDisabled(t *testing.T) {
+	withConfig(t, func(c *Config) { c.ExperimentVariants = nil })
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(experimentHeader, "treatment")
+	if variant, ok := requestVariant(req); ok {
+		t.Errorf("Expected no variant when none are configured, got %q", variant)
+	}
+}
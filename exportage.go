@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exportClock timestamps successful exports for the
+// otlp_seconds_since_last_export gauge.
+var exportClock clock = systemClock{}
+
+// lastExport holds the time of the most recent successful OTLP export, in
+// Unix nanoseconds.
+type lastExport struct {
+	nanos atomic.Int64
+}
+
+func (l *lastExport) mark() {
+	l.nanos.Store(exportClock.Now().UnixNano())
+}
+
+// secondsSince returns how long ago the last successful export was.
+func (l *lastExport) secondsSince() float64 {
+	return exportClock.Now().Sub(time.Unix(0, l.nanos.Load())).Seconds()
+}
+
+// lastExportSpanExporter marks the app's lastExport after each successful
+// span export.
+type lastExportSpanExporter struct {
+	sdktrace.SpanExporter
+	app *App
+}
+
+func (e lastExportSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err == nil {
+		e.app.lastExport.mark()
+	}
+	return err
+}
+
+// lastExportMetricExporter marks the app's lastExport after each successful
+// metric export.
+type lastExportMetricExporter struct {
+	sdkmetric.Exporter
+	app *App
+}
+
+func (e lastExportMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	if err == nil {
+		e.app.lastExport.mark()
+	}
+	return err
+}
+
+// registerExportAgeGauge reports the time since l's last successful export
+// through the otlp_seconds_since_last_export gauge. Until the first export
+// succeeds it counts from registration, so a collector that is never
+// reachable still shows a growing value.
+func registerExportAgeGauge(m metric.Meter, l *lastExport) error {
+	age, err := m.Float64ObservableGauge(
+		"otlp_seconds_since_last_export",
+		metric.WithDescription("Seconds since the last successful OTLP span or metric export"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	l.mark()
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(age, l.secondsSince())
+		return nil
+	}, age)
+	return err
+}
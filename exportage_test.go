@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// flakySpanExporter accepts the first export and fails every later one, as
+// if the collector went away.
+type flakySpanExporter struct {
+	stubSpanExporter
+	calls int
+}
+
+func (e *flakySpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.calls++
+	if e.calls > 1 {
+		return errors.New("collector unreachable")
+	}
+	return e.stubSpanExporter.ExportSpans(ctx, spans)
+}
+
+// exportAge returns the current otlp_seconds_since_last_export value.
+func exportAge(t *testing.T) float64 {
+	t.Helper()
+	m, ok := findMetric(collectMetrics(t), "otlp_seconds_since_last_export")
+	if !ok {
+		t.Fatal("Expected otlp_seconds_since_last_export to be collected")
+	}
+	return m.Data.(metricdata.Gauge[float64]).DataPoints[0].Value
+}
+
+func TestSecondsSinceLastExport(t *testing.T) {
+	orig := exportClock
+	exportClock = &steppingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), step: time.Second}
+	t.Cleanup(func() { exportClock = orig })
+
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	exporter := lastExportSpanExporter{&flakySpanExporter{}, app}
+
+	if err := exporter.ExportSpans(context.Background(), nil); err != nil {
+		t.Fatalf("Expected the first export to succeed, got %v", err)
+	}
+	age := exportAge(t)
+
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportSpans(context.Background(), nil); err == nil {
+			t.Fatal("Expected the export to fail")
+		}
+		next := exportAge(t)
+		if next <= age {
+			t.Errorf("Expected the gauge to grow after failed export %d, went from %v to %v", i+1, age, next)
+		}
+		age = next
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// exporters are the OTLP exporters feeding the tracer, meter and logger
+// providers. log is nil when no log endpoint is configured.
+type exporters struct {
+	trace  sdktrace.SpanExporter
+	metric sdkmetric.Exporter
+	log    sdklog.Exporter
+}
+
+// exportersHook, when set, wraps the exporters newExporters creates. Tests
+// use it to inject export failures.
+var exportersHook func(*exporters) *exporters
+
+// newExporters creates the OTLP exporters for the endpoints in cfg. Each
+// signal is built independently, so each may use its own protocol.
+func newExporters(ctx context.Context, cfg *Config) (*exporters, error) {
+	traceExporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	metricExporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		traceExporter.Shutdown(ctx)
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+
+	var logExporter sdklog.Exporter
+	if cfg.LogEndpoint != "" {
+		logExporter, err = newLogExporter(ctx, cfg)
+		if err != nil {
+			traceExporter.Shutdown(ctx)
+			metricExporter.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		}
+	}
+
+	exp := &exporters{trace: traceExporter, metric: metricExporter, log: logExporter}
+	if exportersHook != nil {
+		exp = exportersHook(exp)
+	}
+	return exp, nil
+}
+
+// newTraceExporter creates the span exporter for cfg's trace protocol.
+// The URL path override only applies to HTTP. Unless cfg.Insecure is set,
+// the connection uses at least cfg.TLSMinVersion.
+func newTraceExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, error) {
+	if cfg.traceProtocol() == "grpc" {
+		var opts []otlptracegrpc.Option
+		if cfg.TraceEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.TraceEndpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig())))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.TraceEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TraceEndpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(cfg.tlsConfig()))
+	}
+	if cfg.OTLPTraceURLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(cfg.OTLPTraceURLPath))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// newMetricExporter creates the metric exporter for cfg's metric protocol.
+// The URL path override only applies to HTTP. Unless cfg.Insecure is set,
+// the connection uses at least cfg.TLSMinVersion.
+func newMetricExporter(ctx context.Context, cfg *Config) (sdkmetric.Exporter, error) {
+	if cfg.metricProtocol() == "grpc" {
+		var opts []otlpmetricgrpc.Option
+		if cfg.MetricEndpoint != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.MetricEndpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig())))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	var opts []otlpmetrichttp.Option
+	if cfg.MetricEndpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.MetricEndpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(cfg.tlsConfig()))
+	}
+	if cfg.OTLPMetricURLPath != "" {
+		opts = append(opts, otlpmetrichttp.WithURLPath(cfg.OTLPMetricURLPath))
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+// newLogExporter creates the log exporter for cfg.LogEndpoint and cfg's log
+// protocol, over TLS of at least cfg.TLSMinVersion unless cfg.Insecure is
+// set.
+func newLogExporter(ctx context.Context, cfg *Config) (sdklog.Exporter, error) {
+	if cfg.logProtocol() == "grpc" {
+		opts := []otlploggrpc.Option{otlploggrpc.WithEndpointURL(cfg.LogEndpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlploggrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig())))
+		}
+		return otlploggrpc.New(ctx, opts...)
+	}
+
+	opts := []otlploghttp.Option{otlploghttp.WithEndpointURL(cfg.LogEndpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlploghttp.WithInsecure())
+	} else {
+		opts = append(opts, otlploghttp.WithTLSClientConfig(cfg.tlsConfig()))
+	}
+	return otlploghttp.New(ctx, opts...)
+}
+
+// newExportersWithTimeout creates the exporters but gives up after
+// cfg.TelemetryInitTimeout, so a slowly resolving collector hostname cannot
+// block startup indefinitely. Exporters that finish after the deadline are
+// shut down.
+func newExportersWithTimeout(cfg *Config) (*exporters, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TelemetryInitTimeout)
+	defer cancel()
+
+	type result struct {
+		exp *exporters
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		exp, err := newExporters(ctx, cfg)
+		done <- result{exp: exp, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.exp, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.err == nil {
+				res.exp.shutdown(context.Background())
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %s creating exporters: %w", cfg.TelemetryInitTimeout, ctx.Err())
+	}
+}
+
+// connectExporters creates the exporters and, when
+// cfg.TelemetryInitMaxElapsed is set, verifies the collector accepts an
+// (empty) metric export, retrying with exponential backoff from
+// cfg.TelemetryInitRetryInterval until the budget is spent. This lets the
+// app wait for a collector that starts after it instead of crash-looping.
+func connectExporters(cfg *Config) (*exporters, error) {
+	if cfg.TelemetryInitMaxElapsed <= 0 {
+		return newExportersWithTimeout(cfg)
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = cfg.TelemetryInitRetryInterval
+	return backoff.Retry(context.Background(), func() (*exporters, error) {
+		exp, err := newExportersWithTimeout(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.TelemetryInitTimeout)
+		defer cancel()
+		if err := exp.metric.Export(ctx, &metricdata.ResourceMetrics{}); err != nil {
+			exp.shutdown(ctx)
+			return nil, fmt.Errorf("collector not reachable: %w", err)
+		}
+		exportSucceeded.Store(true)
+		return exp, nil
+	},
+		backoff.WithBackOff(b),
+		backoff.WithMaxElapsedTime(cfg.TelemetryInitMaxElapsed),
+		backoff.WithNotify(func(err error, next time.Duration) {
+			slog.Warn("Telemetry init failed, retrying", "error", err, "retry_in", next)
+		}),
+	)
+}
+
+func (e *exporters) shutdown(ctx context.Context) error {
+	err := errors.Join(e.trace.Shutdown(ctx), e.metric.Shutdown(ctx))
+	if e.log != nil {
+		err = errors.Join(err, e.log.Shutdown(ctx))
+	}
+	return err
+}
+
+// batchSizeSpanExporter records the number of spans in each export in the
+// app's exportBatchSize, to help tune batching.
+type batchSizeSpanExporter struct {
+	sdktrace.SpanExporter
+	app *App
+}
+
+func (e batchSizeSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.app.exportBatchSize.Record(ctx, int64(len(spans)), metric.WithAttributes(attribute.String("signal", "traces")))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+// batchSizeMetricExporter records the number of metrics in each export in
+// the app's exportBatchSize.
+type batchSizeMetricExporter struct {
+	sdkmetric.Exporter
+	app *App
+}
+
+func (e batchSizeMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var n int
+	for _, sm := range rm.ScopeMetrics {
+		n += len(sm.Metrics)
+	}
+	e.app.exportBatchSize.Record(ctx, int64(n), metric.WithAttributes(attribute.String("signal", "metrics")))
+	return e.Exporter.Export(ctx, rm)
+}
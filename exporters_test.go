@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestInitTelemetryTimeout(t *testing.T) {
+	// Exporter creation that never finishes, like a collector hostname
+	// whose lookup hangs
+	release := make(chan struct{})
+	exportersHook = func(exp *exporters) *exporters {
+		<-release
+		return exp
+	}
+	t.Cleanup(func() {
+		close(release)
+		exportersHook = nil
+	})
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("TELEMETRY_INIT_TIMEOUT", "100ms")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+	withConfig(t, func(c *Config) { *c = *cfg })
+
+	start := time.Now()
+	_, err := initTelemetry(cfg)
+	if elapsed := time.Since(start); elapsed > cfg.TelemetryInitTimeout+500*time.Millisecond {
+		t.Errorf("Expected initTelemetry to give up after %s, took %s", cfg.TelemetryInitTimeout, elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
+
+func TestInitTelemetryFailureShutsDownExporters(t *testing.T) {
+	var shutdowns atomic.Int32
+	exportersHook = func(exp *exporters) *exporters {
+		return &exporters{
+			trace:  shutdownSpanExporter{exp.trace, &shutdowns},
+			metric: shutdownMetricExporter{exp.metric, &shutdowns},
+		}
+	}
+	t.Cleanup(func() { exportersHook = nil })
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	cfg := LoadConfigFromEnv()
+	// Fails after the exporters are created
+	cfg.TraceSampler = "traceidratio"
+	cfg.TraceSamplerArg = "lots"
+	withConfig(t, func(c *Config) { *c = *cfg })
+
+	prevTracerProvider, prevMeterProvider := otel.GetTracerProvider(), otel.GetMeterProvider()
+	if _, err := initTelemetry(cfg); err == nil {
+		t.Fatal("Expected initTelemetry to fail")
+	}
+	if got := shutdowns.Load(); got != 2 {
+		t.Errorf("Expected the trace and metric exporters shut down, got %d shutdowns", got)
+	}
+	if otel.GetTracerProvider() != prevTracerProvider || otel.GetMeterProvider() != prevMeterProvider {
+		t.Error("Expected the global providers to be left as they were")
+	}
+}
+
+// shutdownSpanExporter and shutdownMetricExporter count Shutdown calls.
+type shutdownSpanExporter struct {
+	sdktrace.SpanExporter
+	shutdowns *atomic.Int32
+}
+
+func (e shutdownSpanExporter) Shutdown(ctx context.Context) error {
+	e.shutdowns.Add(1)
+	return e.SpanExporter.Shutdown(ctx)
+}
+
+type shutdownMetricExporter struct {
+	sdkmetric.Exporter
+	shutdowns *atomic.Int32
+}
+
+func (e shutdownMetricExporter) Shutdown(ctx context.Context) error {
+	e.shutdowns.Add(1)
+	return e.Exporter.Shutdown(ctx)
+}
+
+func TestInitTelemetryUnreachableCollector(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector.invalid:4318")
+	t.Setenv("TELEMETRY_INIT_TIMEOUT", "200ms")
+	t.Setenv("TELEMETRY_INIT_RETRY_INTERVAL", "50ms")
+	t.Setenv("TELEMETRY_INIT_MAX_ELAPSED", "300ms")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+	withConfig(t, func(c *Config) { *c = *cfg })
+
+	start := time.Now()
+	_, err := initTelemetry(cfg)
+	budget := cfg.TelemetryInitMaxElapsed + cfg.TelemetryInitTimeout + 500*time.Millisecond
+	if elapsed := time.Since(start); elapsed > budget {
+		t.Errorf("Expected initTelemetry to give up within %s, took %s", budget, elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "collector not reachable") {
+		t.Errorf("Expected an unreachable collector error, got %v", err)
+	}
+}
+
+func TestNewExportersExplicitEndpoints(t *testing.T) {
+	var traceHits, metricHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/traces", func(w http.ResponseWriter, r *http.Request) {
+		traceHits.Add(1)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metricHits.Add(1)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Endpoints set on the Config need no process environment
+	cfg := LoadConfigFromEnv()
+	cfg.TraceEndpoint = srv.URL + "/traces"
+	cfg.MetricEndpoint = srv.URL + "/metrics"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	exp, err := newExporters(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporters: %v", err)
+	}
+	defer exp.shutdown(ctx)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp.trace))
+	_, span := provider.Tracer("test").Start(ctx, "exported")
+	span.End()
+	provider.Shutdown(ctx)
+
+	if err := exp.metric.Export(ctx, &metricdata.ResourceMetrics{}); err != nil {
+		t.Fatalf("Failed to export metrics: %v", err)
+	}
+
+	if got := traceHits.Load(); got != 1 {
+		t.Errorf("Expected 1 trace export at the configured endpoint, got %d", got)
+	}
+	if got := metricHits.Load(); got != 1 {
+		t.Errorf("Expected 1 metric export at the configured endpoint, got %d", got)
+	}
+}
+
+// traceClientType returns the Type an OTLP span exporter's client reports
+// through MarshalLog, e.g. "otlptracegrpc".
+func traceClientType(t *testing.T, exp sdktrace.SpanExporter) string {
+	t.Helper()
+	otlp, ok := exp.(*otlptrace.Exporter)
+	if !ok {
+		t.Fatalf("Expected an *otlptrace.Exporter, got %T", exp)
+	}
+	client := reflect.ValueOf(otlp.MarshalLog()).FieldByName("Client").Interface()
+	logger, ok := client.(interface{ MarshalLog() interface{} })
+	if !ok {
+		t.Fatalf("Expected the trace client %T to implement MarshalLog", client)
+	}
+	return reflect.ValueOf(logger.MarshalLog()).FieldByName("Type").String()
+}
+
+func TestNewExportersMixedProtocols(t *testing.T) {
+	tests := []struct {
+		name           string
+		traceProtocol  string
+		metricProtocol string
+		wantTrace      string
+		wantMetric     string
+	}{
+		{
+			name:           "traces grpc, metrics http",
+			traceProtocol:  "grpc",
+			metricProtocol: "http",
+			wantTrace:      "otlptracegrpc",
+			wantMetric:     "*otlpmetrichttp.Exporter",
+		},
+		{
+			name:           "traces http, metrics grpc",
+			traceProtocol:  "http",
+			metricProtocol: "grpc",
+			wantTrace:      "otlptracehttp",
+			wantMetric:     "*otlpmetricgrpc.Exporter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.OTLPTraceProtocol = tt.traceProtocol
+			cfg.OTLPMetricProtocol = tt.metricProtocol
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Invalid configuration: %v", err)
+			}
+
+			ctx := context.Background()
+			exp, err := newExporters(ctx, cfg)
+			if err != nil {
+				t.Fatalf("Failed to create exporters: %v", err)
+			}
+			defer exp.shutdown(ctx)
+
+			if got := traceClientType(t, exp.trace); got != tt.wantTrace {
+				t.Errorf("Expected trace client %s, got %s", tt.wantTrace, got)
+			}
+			if got := fmt.Sprintf("%T", exp.metric); got != tt.wantMetric {
+				t.Errorf("Expected metric exporter %s, got %s", tt.wantMetric, got)
+			}
+		})
+	}
+}
+
+func TestNewExportersGRPCFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "http://localhost:4317")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	exp, err := newExporters(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporters: %v", err)
+	}
+	defer exp.shutdown(ctx)
+
+	if got := traceClientType(t, exp.trace); got != "otlptracegrpc" {
+		t.Errorf("Expected trace client otlptracegrpc, got %s", got)
+	}
+	if _, ok := exp.metric.(*otlpmetricgrpc.Exporter); !ok {
+		t.Errorf("Expected an *otlpmetricgrpc.Exporter, got %T", exp.metric)
+	}
+	if _, ok := exp.log.(*otlploggrpc.Exporter); !ok {
+		t.Errorf("Expected an *otlploggrpc.Exporter, got %T", exp.log)
+	}
+}
+
+func TestNewExportersURLPath(t *testing.T) {
+	var traceHits, metricHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/otlp/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		traceHits.Add(1)
+	})
+	mux.HandleFunc("/otlp/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metricHits.Add(1)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTLP_TRACE_URL_PATH", "/otlp/v1/traces")
+	t.Setenv("OTLP_METRIC_URL_PATH", "/otlp/v1/metrics")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	exp, err := newExporters(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create exporters: %v", err)
+	}
+	defer exp.shutdown(ctx)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp.trace))
+	_, span := provider.Tracer("test").Start(ctx, "exported")
+	span.End()
+	provider.Shutdown(ctx)
+
+	if err := exp.metric.Export(ctx, &metricdata.ResourceMetrics{}); err != nil {
+		t.Fatalf("Failed to export metrics: %v", err)
+	}
+
+	if got := traceHits.Load(); got != 1 {
+		t.Errorf("Expected 1 trace export at the custom path, got %d", got)
+	}
+	if got := metricHits.Load(); got != 1 {
+		t.Errorf("Expected 1 metric export at the custom path, got %d", got)
+	}
+}
+
+func TestConnectExportersWaitsForCollector(t *testing.T) {
+	// Reserve a port, then free it so the collector is unreachable at first
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	var exports atomic.Int32
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exports.Add(1)
+	})}
+	defer srv.Close()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("Failed to start the collector stub: %v", err)
+			return
+		}
+		srv.Serve(ln)
+	}()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://"+addr)
+	t.Setenv("TELEMETRY_INIT_TIMEOUT", "200ms")
+	t.Setenv("TELEMETRY_INIT_MAX_ELAPSED", "5s")
+	t.Setenv("TELEMETRY_INIT_RETRY_INTERVAL", "50ms")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	start := time.Now()
+	exp, err := connectExporters(cfg)
+	if err != nil {
+		t.Fatalf("Expected init to succeed once the collector is up, got %v", err)
+	}
+	defer exp.shutdown(context.Background())
+
+	if elapsed := time.Since(start); elapsed > cfg.TelemetryInitMaxElapsed {
+		t.Errorf("Expected init within %s, took %s", cfg.TelemetryInitMaxElapsed, elapsed)
+	}
+	if exports.Load() == 0 {
+		t.Error("Expected the collector stub to receive the verification export")
+	}
+}
+
+func TestBatchSizeSpanExporter(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	stub := &stubSpanExporter{}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(batchSizeSpanExporter{stub, app}))
+	for i := 0; i < 3; i++ {
+		_, span := provider.Tracer("test").Start(context.Background(), "batched")
+		span.End()
+	}
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	provider.Shutdown(context.Background())
+
+	m, ok := findMetric(collectMetrics(t), "otlp_export_batch_size")
+	if !ok {
+		t.Fatal("Expected otlp_export_batch_size to be collected")
+	}
+	var found bool
+	for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+		if !hasAttributes(dp.Attributes, attribute.String("signal", "traces")) {
+			continue
+		}
+		found = true
+		if dp.Count != 1 || dp.Sum != 3 {
+			t.Errorf("Expected one export of 3 spans, got %d exports totalling %d spans", dp.Count, dp.Sum)
+		}
+	}
+	if !found {
+		t.Error("Expected a data point for signal=traces")
+	}
+}
+
+// errInjectedFault is the error faultInjector fails exports with.
+var errInjectedFault = errors.New("injected export fault")
+
+// faultInjector fails the first failures exports through the exporters it
+// wraps, counted across all of them, then lets exports through. Install it
+// with exportersHook to exercise retries against a healthy collector.
+type faultInjector struct {
+	failures atomic.Int32
+	attempts atomic.Int32
+	// onFault, if set, runs after each injected failure.
+	onFault func()
+}
+
+func newFaultInjector(failures int) *faultInjector {
+	f := &faultInjector{}
+	f.failures.Store(int32(failures))
+	return f
+}
+
+func (f *faultInjector) fault() error {
+	f.attempts.Add(1)
+	if f.failures.Add(-1) < 0 {
+		return nil
+	}
+	if f.onFault != nil {
+		f.onFault()
+	}
+	return errInjectedFault
+}
+
+func (f *faultInjector) wrap(exp *exporters) *exporters {
+	return &exporters{
+		trace:  faultSpanExporter{exp.trace, f},
+		metric: faultMetricExporter{exp.metric, f},
+		log:    exp.log,
+	}
+}
+
+type faultSpanExporter struct {
+	sdktrace.SpanExporter
+	faults *faultInjector
+}
+
+func (e faultSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.faults.fault(); err != nil {
+		return err
+	}
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+type faultMetricExporter struct {
+	sdkmetric.Exporter
+	faults *faultInjector
+}
+
+func (e faultMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if err := e.faults.fault(); err != nil {
+		return err
+	}
+	return e.Exporter.Export(ctx, rm)
+}
+
+func TestConnectExportersRetriesInjectedFaults(t *testing.T) {
+	t.Cleanup(func() {
+		exportersHook = nil
+		telemetryReady.Store(false)
+		exportSucceeded.Store(false)
+	})
+	telemetryReady.Store(true)
+	exportSucceeded.Store(false)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		readyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+	faults := newFaultInjector(3)
+	faults.onFault = func() {
+		if got := ready(); got != http.StatusServiceUnavailable {
+			t.Errorf("Expected /ready %d while exports fail, got %d", http.StatusServiceUnavailable, got)
+		}
+	}
+	exportersHook = faults.wrap
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("TELEMETRY_INIT_MAX_ELAPSED", "5s")
+	t.Setenv("TELEMETRY_INIT_RETRY_INTERVAL", "10ms")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	exp, err := connectExporters(cfg)
+	if err != nil {
+		t.Fatalf("Expected init to succeed after the injected faults, got %v", err)
+	}
+	defer exp.shutdown(context.Background())
+
+	if got := faults.attempts.Load(); got != 4 {
+		t.Errorf("Expected 3 failed verification exports and 1 success, got %d attempts", got)
+	}
+	if got := ready(); got != http.StatusOK {
+		t.Errorf("Expected /ready %d after the first successful export, got %d", http.StatusOK, got)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// atomicFloat64 is a float64 that can be read and replaced concurrently.
+type atomicFloat64 struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat64) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat64) Store(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+// errorRate is the probability that a /work request fails. It starts from
+// Config.ErrorRate and can be changed live through /admin/flags or, with
+// reloadErrorRate, on SIGHUP.
+var errorRate atomicFloat64
+
+func init() {
+	errorRate.Store(appConfig.ErrorRate)
+}
+
+// featureFlagsKey records the flags enabled when a request started on its
+// server span.
+const featureFlagsKey = attribute.Key("feature_flags")
+
+// maxSpanFeatureFlags bounds how many flag names featureFlagsKey lists; the
+// rest are summarized as "+N".
+const maxSpanFeatureFlags = 16
+
+// maxFeatureFlagNameLength bounds the length of a flag name, so the
+// feature_flags attribute stays bounded too.
+const maxFeatureFlagNameLength = 64
+
+// validateFeatureFlag reports whether name is a usable flag name.
+func validateFeatureFlag(name string) error {
+	if len(name) > maxFeatureFlagNameLength {
+		return fmt.Errorf("invalid feature flag %q: must be at most %d bytes", name, maxFeatureFlagNameLength)
+	}
+	return nil
+}
+
+// featureFlagStore holds the named behavior switches that are on. An App's
+// store starts from Config.FeatureFlags and can be changed live through
+// /admin/flags.
+type featureFlagStore struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+}
+
+// reset enables exactly the flags in names.
+func (s *featureFlagStore) reset(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enabled = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.enabled[name] = true
+	}
+}
+
+// set turns the flag name on or off.
+func (s *featureFlagStore) set(name string, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enabled == nil {
+		s.enabled = make(map[string]bool)
+	}
+	if on {
+		s.enabled[name] = true
+	} else {
+		delete(s.enabled, name)
+	}
+}
+
+// list returns the enabled flags, sorted.
+func (s *featureFlagStore) list() []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.enabled))
+	for name := range s.enabled {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// attribute returns the enabled flags as a comma-separated featureFlagsKey
+// attribute listing at most maxSpanFeatureFlags names, or false when none
+// are enabled.
+func (s *featureFlagStore) attribute() (attribute.KeyValue, bool) {
+	names := s.list()
+	if len(names) == 0 {
+		return attribute.KeyValue{}, false
+	}
+	if extra := len(names) - maxSpanFeatureFlags; extra > 0 {
+		names = append(names[:maxSpanFeatureFlags], "+"+strconv.Itoa(extra))
+	}
+	return featureFlagsKey.String(strings.Join(names, ",")), true
+}
+
+// validateErrorRate reports whether rate is a usable probability.
+func validateErrorRate(rate float64) error {
+	if math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return fmt.Errorf("invalid error rate %v: must be between 0.0 and 1.0", rate)
+	}
+	return nil
+}
+
+// reloadErrorRate applies the error rate in cfg.ErrorRateFile, or, when no
+// file is configured, restores cfg.ErrorRate, the rate the flags and
+// environment set at startup. The latest change wins, so a reload replaces
+// any rate set through /admin/flags. An unreadable or invalid file leaves
+// the live rate unchanged.
+func reloadErrorRate(cfg *Config) error {
+	rate, source := cfg.ErrorRate, "startup"
+	if cfg.ErrorRateFile != "" {
+		data, err := os.ReadFile(cfg.ErrorRateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read error rate file: %w", err)
+		}
+		rate, err = strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			return fmt.Errorf("invalid error rate in %s: %w", cfg.ErrorRateFile, err)
+		}
+		if err := validateErrorRate(rate); err != nil {
+			return err
+		}
+		source = cfg.ErrorRateFile
+	}
+	previous := errorRate.Load()
+	errorRate.Store(rate)
+	slog.Info("Reloaded error rate", "error_rate", rate, "previous", previous, "source", source)
+	return nil
+}
+
+// flagsHandler reports the runtime-adjustable settings as JSON. A POST with
+// an error_rate parameter replaces the live /work error rate, and enable and
+// disable parameters, each a comma-separated list, switch a's feature flags.
+// Nothing is changed unless every parameter is valid.
+func (a *App) flagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		raw := r.FormValue("error_rate")
+		var rate float64
+		if raw != "" {
+			var err error
+			rate, err = strconv.ParseFloat(raw, 64)
+			if err == nil {
+				err = validateErrorRate(rate)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid error_rate %q: must be between 0.0 and 1.0", raw), http.StatusBadRequest)
+				return
+			}
+		}
+		enable, disable := splitList(r.FormValue("enable")), splitList(r.FormValue("disable"))
+		for _, name := range append(slices.Clone(enable), disable...) {
+			if err := validateFeatureFlag(name); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if raw != "" {
+			errorRate.Store(rate)
+			slog.InfoContext(r.Context(), "Updated error rate", "error_rate", rate)
+		}
+		for _, name := range enable {
+			a.flags.set(name, true)
+			slog.InfoContext(r.Context(), "Enabled feature flag", "flag", name)
+		}
+		for _, name := range disable {
+			a.flags.set(name, false)
+			slog.InfoContext(r.Context(), "Disabled feature flag", "flag", name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"error_rate":    errorRate.Load(),
+		"feature_flags": a.flags.list(),
+	})
+}
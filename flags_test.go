@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorRateHotReload(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.AdminToken = "s3cret"
+		c.MaxWorkLatency = 5 * time.Millisecond
+	})
+	orig := errorRate.Load()
+	t.Cleanup(func() { errorRate.Store(orig) })
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/flags?error_rate=1.0", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	requireAdmin(app.flagsHandler)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d updating error rate, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		app.serveWork(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected every /work to fail at error rate 1.0, request %d got %d", i, w.Code)
+		}
+	}
+}
+
+func TestFlagsHandlerRejectsInvalidRate(t *testing.T) {
+	app := &App{}
+	orig := errorRate.Load()
+	t.Cleanup(func() { errorRate.Store(orig) })
+
+	tests := []struct {
+		name string
+		rate string
+	}{
+		{name: "above one", rate: "1.5"},
+		{name: "negative", rate: "-0.1"},
+		{name: "not a number", rate: "lots"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/flags?error_rate="+tt.rate, nil)
+			w := httptest.NewRecorder()
+			app.flagsHandler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if errorRate.Load() != orig {
+				t.Errorf("Expected error rate to stay %v, got %v", orig, errorRate.Load())
+			}
+		})
+	}
+}
+
+func TestReloadErrorRate(t *testing.T) {
+	orig := errorRate.Load()
+	t.Cleanup(func() { errorRate.Store(orig) })
+
+	file := filepath.Join(t.TempDir(), "error_rate")
+	write := func(v string) {
+		if err := os.WriteFile(file, []byte(v), 0o600); err != nil {
+			t.Fatalf("Failed to write error rate file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    float64
+		wantErr bool
+	}{
+		{name: "file replaces the admin override", file: file, content: "0.25\n", want: 0.25},
+		{name: "no file restores the startup rate", want: 0.05},
+		{name: "invalid file keeps the live rate", file: file, content: "1.5", want: 0.75, wantErr: true},
+		{name: "missing file keeps the live rate", file: filepath.Join(t.TempDir(), "absent"), want: 0.75, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write(tt.content)
+			// An operator overrode the rate through /admin/flags
+			errorRate.Store(0.75)
+
+			err := reloadErrorRate(&Config{ErrorRate: 0.05, ErrorRateFile: tt.file})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reloadErrorRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errorRate.Load(); got != tt.want {
+				t.Errorf("Expected error rate %v after reload, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFeatureFlagsSpanAttribute(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	app.flagsHandler(w, httptest.NewRequest(http.MethodPost, "/admin/flags?enable=new-cache,dark-mode", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d enabling flags, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	got, ok := spanAttribute(endedSpan(t, "health_check"), "feature_flags")
+	if !ok || got.AsString() != "dark-mode,new-cache" {
+		t.Errorf("Expected feature_flags %q, got %q", "dark-mode,new-cache", got.AsString())
+	}
+
+	app.flagsHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/flags?disable=dark-mode,new-cache", nil))
+	app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got, ok := spanAttribute(endedSpan(t, "health_check"), "feature_flags"); ok {
+		t.Errorf("Expected no feature_flags with every flag disabled, got %q", got.AsString())
+	}
+}
+
+func TestFlagsHandlerRejectsLongFlagName(t *testing.T) {
+	app := &App{}
+	orig := errorRate.Load()
+	t.Cleanup(func() { errorRate.Store(orig) })
+
+	long := strings.Repeat("x", maxFeatureFlagNameLength+1)
+	req := httptest.NewRequest(http.MethodPost, "/admin/flags?error_rate=0.5&enable=new-cache,"+long, nil)
+	w := httptest.NewRecorder()
+	app.flagsHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if got := app.flags.list(); len(got) != 0 {
+		t.Errorf("Expected no flags enabled by a rejected request, got %v", got)
+	}
+	if errorRate.Load() != orig {
+		t.Errorf("Expected error rate to stay %v, got %v", orig, errorRate.Load())
+	}
+}
+
+func TestFeatureFlagsAttributeBounded(t *testing.T) {
+	names := make([]string, maxSpanFeatureFlags+3)
+	for i := range names {
+		names[i] = fmt.Sprintf("flag-%02d", i)
+	}
+	var s featureFlagStore
+	s.reset(names)
+
+	got, _ := s.attribute()
+	want := strings.Join(names[:maxSpanFeatureFlags], ",") + ",+3"
+	if got.Value.AsString() != want {
+		t.Errorf("Expected feature_flags %q, got %q", want, got.Value.AsString())
+	}
+}
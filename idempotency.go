@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader is the request header clients use to mark retries of
+// the same logical /work request.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyTTL bounds how long a completed response is replayed for a key.
+const idempotencyTTL = 10 * time.Minute
+
+// idempotencyMaxEntries bounds how many responses are kept; clients choose
+// the keys, so without it fresh keys would grow the cache without limit.
+const idempotencyMaxEntries = 10000
+
+type cachedResponse struct {
+	status  int
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyEntry is a cached response and the key it is stored under.
+type idempotencyEntry struct {
+	key string
+	cachedResponse
+}
+
+// idempotencyCache remembers completed /work responses by idempotency key so
+// that retried requests are answered without repeating the work. Entries
+// are kept in the order they were stored, which with a fixed TTL is also
+// the order they expire in, so expired entries and, past maxEntries, the
+// oldest ones are dropped from the front without scanning the rest.
+type idempotencyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func newIdempotencyCache(ttl time.Duration, maxEntries int) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *idempotencyCache) get(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	entry := elem.Value.(*idempotencyEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return cachedResponse{}, false
+	}
+	return entry.cachedResponse, true
+}
+
+func (c *idempotencyCache) set(key string, status int, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for elem := c.order.Front(); elem != nil && now.After(elem.Value.(*idempotencyEntry).expires); elem = c.order.Front() {
+		c.remove(elem)
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushBack(&idempotencyEntry{
+		key: key,
+		cachedResponse: cachedResponse{
+			status:  status,
+			body:    body,
+			expires: now.Add(c.ttl),
+		},
+	})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Front())
+	}
+}
+
+// len returns the number of stored responses, expired or not.
+func (c *idempotencyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// remove drops elem; c.mu must be held.
+func (c *idempotencyCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*idempotencyEntry).key)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkHandlerCacheHit(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{
+			name:     "first request misses",
+			expected: false,
+		},
+		{
+			name:     "repeated request hits",
+			expected: true,
+		},
+	}
+
+	var firstBody string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/work", nil)
+			req.Header.Set(idempotencyKeyHeader, "cache-hit-test")
+			w := httptest.NewRecorder()
+
+			app.serveWork(w, req)
+
+			value, ok := spanAttribute(endedSpan(t, "do_work"), "cache.hit")
+			if !ok {
+				t.Fatal("Expected cache.hit attribute on do_work span")
+			}
+			if value.AsBool() != tt.expected {
+				t.Errorf("Expected cache.hit=%v, got %v", tt.expected, value.AsBool())
+			}
+
+			if firstBody == "" {
+				firstBody = w.Body.String()
+			} else if w.Body.String() != firstBody {
+				t.Errorf("Expected replayed body %q, got %q", firstBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWorkHandlerWithoutIdempotencyKey(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/work", nil)
+	w := httptest.NewRecorder()
+
+	app.serveWork(w, req)
+
+	if _, ok := spanAttribute(endedSpan(t, "do_work"), "cache.hit"); ok {
+		t.Error("Expected no cache.hit attribute without an idempotency key")
+	}
+}
+
+func TestWorkHandlerCoalescesConcurrentRequests(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.CoalesceWork = true
+		c.MinWorkLatency = 200 * time.Millisecond
+		c.MaxWorkLatency = 200 * time.Millisecond
+	})
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 2)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/work", nil)
+		req.Header.Set(idempotencyKeyHeader, "coalesce-"+t.Name())
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			app.serveWork(w, req)
+		}(recorders[i])
+	}
+	wg.Wait()
+
+	var executions int
+	for _, span := range spanRecorder.Ended() {
+		if span.Name() == "nested_operation" {
+			executions++
+		}
+	}
+	if executions != 1 {
+		t.Errorf("Expected the work to run once, ran %d times", executions)
+	}
+	if recorders[0].Code != recorders[1].Code || recorders[0].Body.String() != recorders[1].Body.String() {
+		t.Errorf("Expected identical responses, got %d %q and %d %q",
+			recorders[0].Code, recorders[0].Body.String(), recorders[1].Code, recorders[1].Body.String())
+	}
+}
+
+func TestWorkHandlerCoalescedLeaderDisconnects(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.CoalesceWork = true
+		c.MinWorkLatency = 200 * time.Millisecond
+		c.MaxWorkLatency = 200 * time.Millisecond
+	})
+	orig := errorRate.Load()
+	t.Cleanup(func() { errorRate.Store(orig) })
+	errorRate.Store(0)
+
+	key := "coalesce-" + t.Name()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := httptest.NewRequest(http.MethodGet, "/work", nil).WithContext(ctx)
+	leader.Header.Set(idempotencyKeyHeader, key)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.serveWork(httptest.NewRecorder(), leader)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	follower := httptest.NewRequest(http.MethodGet, "/work", nil)
+	follower.Header.Set(idempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	app.serveWork(w, follower)
+	wg.Wait()
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the follower to get %d after the leader disconnected, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotencyCacheBounded(t *testing.T) {
+	c := newIdempotencyCache(time.Minute, 3)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.set(key, http.StatusOK, []byte(key))
+	}
+
+	if n := c.len(); n != 3 {
+		t.Errorf("Expected 3 entries, got %d", n)
+	}
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected the oldest key to be evicted")
+	}
+	for _, key := range []string{"b", "c", "d"} {
+		if got, ok := c.get(key); !ok || string(got.body) != key {
+			t.Errorf("Expected %q to be kept, got %q (hit=%v)", key, got.body, ok)
+		}
+	}
+}
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	c := newIdempotencyCache(20*time.Millisecond, 10)
+	c.set("old", http.StatusOK, nil)
+	time.Sleep(30 * time.Millisecond)
+	c.set("new", http.StatusOK, nil)
+
+	if n := c.len(); n != 1 {
+		t.Errorf("Expected the expired entry dropped on insert, got %d entries", n)
+	}
+	if _, ok := c.get("new"); !ok {
+		t.Error("Expected the fresh entry to be kept")
+	}
+}
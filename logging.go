@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceHandler wraps a slog.Handler and adds the trace and span IDs of the
+// span in the record's context, so any log made with a context (InfoContext,
+// LogAttrs and so on) correlates with its trace without per-call code.
+type traceHandler struct {
+	slog.Handler
+}
+
+func newTraceHandler(h slog.Handler) *traceHandler {
+	return &traceHandler{Handler: h}
+}
+
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return newTraceHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return newTraceHandler(h.Handler.WithGroup(name))
+}
+
+// otelLogHandler is a slog.Handler that emits records through an
+// OpenTelemetry logger. The SDK takes the trace and span IDs from the
+// record's context, so logs made with a context are queryable by trace in
+// the backend.
+type otelLogHandler struct {
+	logger otellog.Logger
+	attrs  []otellog.KeyValue
+	prefix string
+}
+
+func newOTelLogHandler(logger otellog.Logger) *otelLogHandler {
+	return &otelLogHandler{logger: logger}
+}
+
+func (h *otelLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(ctx, otellog.EnabledParameters{Severity: logSeverity(level)})
+}
+
+func (h *otelLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var record otellog.Record
+	record.SetTimestamp(r.Time)
+	record.SetSeverity(logSeverity(r.Level))
+	record.SetSeverityText(r.Level.String())
+	record.SetBody(otellog.StringValue(r.Message))
+	record.AddAttributes(h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttributes(logKeyValue(h.prefix, a))
+		return true
+	})
+	h.logger.Emit(ctx, record)
+	return nil
+}
+
+func (h *otelLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, logKeyValue(h.prefix, a))
+	}
+	return &next
+}
+
+func (h *otelLogHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
+
+// logSeverity maps a slog level onto the OpenTelemetry severity numbers,
+// where INFO is 9 and each slog step of 4 is one severity range.
+func logSeverity(level slog.Level) otellog.Severity {
+	return otellog.Severity(level + 9)
+}
+
+// logKeyValue converts a slog attribute, qualifying its key with prefix.
+func logKeyValue(prefix string, a slog.Attr) otellog.KeyValue {
+	return otellog.KeyValue{Key: prefix + a.Key, Value: logValue(a.Value)}
+}
+
+func logValue(v slog.Value) otellog.Value {
+	switch v = v.Resolve(); v.Kind() {
+	case slog.KindString:
+		return otellog.StringValue(v.String())
+	case slog.KindInt64:
+		return otellog.Int64Value(v.Int64())
+	case slog.KindUint64:
+		return otellog.Int64Value(int64(v.Uint64()))
+	case slog.KindFloat64:
+		return otellog.Float64Value(v.Float64())
+	case slog.KindBool:
+		return otellog.BoolValue(v.Bool())
+	case slog.KindGroup:
+		kvs := make([]otellog.KeyValue, 0, len(v.Group()))
+		for _, a := range v.Group() {
+			kvs = append(kvs, logKeyValue("", a))
+		}
+		return otellog.MapValue(kvs...)
+	default:
+		return otellog.StringValue(v.String())
+	}
+}
+
+// teeHandler sends each record to every handler that has its level
+// enabled.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make(teeHandler, len(t))
+	for i, h := range t {
+		next[i] = h.WithAttrs(attrs)
+	}
+	return next
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	next := make(teeHandler, len(t))
+	for i, h := range t {
+		next[i] = h.WithGroup(name)
+	}
+	return next
+}
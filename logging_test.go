@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+func TestTraceHandler(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(newTraceHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+
+	ctx, span := app.tracer.Start(context.Background(), "log_span")
+	logger.InfoContext(ctx, "inside span")
+	span.End()
+	logger.InfoContext(context.Background(), "outside span")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+
+	tests := []struct {
+		name        string
+		line        []byte
+		wantTraceID string
+		wantSpanID  string
+	}{
+		{
+			name:        "inside span",
+			line:        lines[0],
+			wantTraceID: span.SpanContext().TraceID().String(),
+			wantSpanID:  span.SpanContext().SpanID().String(),
+		},
+		{
+			name: "outside span",
+			line: lines[1],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record map[string]any
+			if err := json.Unmarshal(tt.line, &record); err != nil {
+				t.Fatalf("Failed to parse log line %q: %v", tt.line, err)
+			}
+			traceID, _ := record["trace_id"].(string)
+			spanID, _ := record["span_id"].(string)
+			if traceID != tt.wantTraceID || spanID != tt.wantSpanID {
+				t.Errorf("Expected trace_id=%q span_id=%q, got trace_id=%q span_id=%q",
+					tt.wantTraceID, tt.wantSpanID, traceID, spanID)
+			}
+			if record["component"] != "test" {
+				t.Errorf("Expected attributes from With to be kept, got %v", record)
+			}
+		})
+	}
+}
+
+// stubLogExporter keeps the log records exported to it.
+type stubLogExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *stubLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+	return nil
+}
+
+func (e *stubLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *stubLogExporter) ForceFlush(context.Context) error { return nil }
+
+func TestAppLogHandlerExportsCorrelatedLogs(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	exporter := &stubLogExporter{}
+	app.loggerProvider = sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+
+	var console bytes.Buffer
+	logger := slog.New(app.logHandler(slog.NewJSONHandler(&console, nil))).WithGroup("work")
+
+	ctx, span := app.tracer.Start(context.Background(), "log_span")
+	logger.WarnContext(ctx, "Simulated error occurred", "type", "processing")
+	span.End()
+
+	if !bytes.Contains(console.Bytes(), []byte("Simulated error occurred")) {
+		t.Errorf("Expected the record on the console too, got %q", console.String())
+	}
+	if len(exporter.records) != 1 {
+		t.Fatalf("Expected 1 exported record, got %d", len(exporter.records))
+	}
+	record := exporter.records[0]
+	if record.TraceID() != span.SpanContext().TraceID() || record.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("Expected trace %s span %s, got trace %s span %s",
+			span.SpanContext().TraceID(), span.SpanContext().SpanID(), record.TraceID(), record.SpanID())
+	}
+	if record.Body().AsString() != "Simulated error occurred" {
+		t.Errorf("Expected the message as the body, got %q", record.Body().AsString())
+	}
+	if record.Severity() != otellog.SeverityWarn {
+		t.Errorf("Expected severity %v, got %v", otellog.SeverityWarn, record.Severity())
+	}
+	var workType string
+	record.WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Key == "work.type" {
+			workType = kv.Value.AsString()
+		}
+		return true
+	})
+	if workType != "processing" {
+		t.Errorf("Expected attribute work.type=processing, got %q", workType)
+	}
+}
+
+func TestAppLogHandlerConsoleFallback(t *testing.T) {
+	console := slog.NewTextHandler(&bytes.Buffer{}, nil)
+	if h := (&App{}).logHandler(console); h != console {
+		t.Errorf("Expected the console handler without a logger provider, got %T", h)
+	}
+}
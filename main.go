@@ -2,88 +2,414 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"math"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	otelruntime "go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
-var (
+// telemetryShutdownTimeout bounds the final flush of spans and metrics on
+// exit.
+const telemetryShutdownTimeout = 5 * time.Second
+
+// App holds the telemetry providers, the tracer and instruments the handlers
+// record to and the request state derived from them, so independent
+// instances can coexist in one process. Process-wide state stays
+// package-level and is shared by every App: the configuration, the live
+// error rate, the shutdown drain, the /debug/tracing counts, the system
+// usage reading and the telemetry resource. main builds one App with
+// initTelemetry and registers its handlers.
+type App struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	// loggerProvider exports logs over OTLP; it is nil when no log endpoint
+	// is configured.
+	loggerProvider *sdklog.LoggerProvider
+
 	tracer          trace.Tracer
 	meter           metric.Meter
 	requestCounter  metric.Int64Counter
 	requestDuration metric.Float64Histogram
-)
+	recordErrors    metric.Int64Counter
 
-func initTelemetry() error {
-	ctx := context.Background()
+	cancelledCounter    metric.Int64Counter
+	preflightCounter    metric.Int64Counter
+	throttledCounter    metric.Int64Counter
+	missingTraceCounter metric.Int64Counter
+	workItemsCounter    metric.Int64Counter
+	exportBatchSize     metric.Int64Histogram
+	downstreamWait      metric.Float64Histogram
+	spansPerRequest     metric.Int64Histogram
+
+	// downstreamSlots caps concurrent downstream calls; nil when unbounded.
+	downstreamSlots chan struct{}
+
+	// rng drives simulated latency and errors; see seedRand.
+	rng randSource
+
+	// lastExport is when the collector last accepted an export, for the
+	// otlp_seconds_since_last_export gauge.
+	lastExport lastExport
+
+	// accessLog picks the requests logAccess writes to the access log.
+	accessLog accessLogSampler
+
+	// flags are the feature flags switched through /admin/flags and listed
+	// on request spans.
+	flags featureFlagStore
+
+	// series counts the attribute sets recorded per instrument.
+	series *seriesTracker
+	// quantiles estimates duration quantiles when
+	// Config.DurationQuantileWindow is set, and is nil otherwise.
+	quantiles *quantileEstimator
+
+	// workCache stores /work responses by idempotency key, and workGroup
+	// coalesces concurrent /work requests by the same key.
+	workCache *idempotencyCache
+	workGroup singleflight.Group
+
+	// snapshotReader is collected on demand to serve /metrics; nil leaves
+	// the snapshot out.
+	snapshotReader *sdkmetric.ManualReader
+}
+
+// newApp builds an App on the given providers.
+func newApp(tp *sdktrace.TracerProvider, mp *sdkmetric.MeterProvider) (*App, error) {
+	a := newDetachedApp()
+	if err := a.init(tp, mp); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newDetachedApp returns an App not yet attached to providers; init
+// attaches it. newApp does both, but initTelemetry needs the App before its
+// providers exist, since its export wrappers record to the App's
+// instruments.
+func newDetachedApp() *App {
+	return &App{rng: newLockedRand(time.Now().UnixNano())}
+}
+
+// init attaches the providers to a and creates its tracer and instruments.
+func (a *App) init(tp *sdktrace.TracerProvider, mp *sdkmetric.MeterProvider) error {
+	a.tracerProvider = tp
+	a.meterProvider = mp
+	a.tracer = countingTracer{tp.Tracer("sample-app", trace.WithInstrumentationVersion("1.0.0"))}
+	a.meter = mp.Meter("sample-app", metric.WithInstrumentationVersion("1.0.0"))
+	if n := appConfig.DownstreamMaxConcurrency; n > 0 {
+		a.downstreamSlots = make(chan struct{}, n)
+	}
+	a.flags.reset(appConfig.FeatureFlags)
+	return a.initInstruments()
+}
+
+// shutdown flushes and stops a's providers.
+func (a *App) shutdown(ctx context.Context) error {
+	err := shutdownProviders(ctx, a.tracerProvider, a.meterProvider)
+	if a.loggerProvider != nil {
+		if lerr := a.loggerProvider.Shutdown(ctx); lerr != nil {
+			err = errors.Join(err, fmt.Errorf("logs pipeline shutdown: %w", lerr))
+		}
+	}
+	return err
+}
+
+// logHandler returns console, additionally exporting each record over OTLP
+// when a has a logger provider.
+func (a *App) logHandler(console slog.Handler) slog.Handler {
+	if a.loggerProvider == nil {
+		return console
+	}
+	logger := a.loggerProvider.Logger("sample-app", otellog.WithInstrumentationVersion("1.0.0"))
+	return teeHandler{console, newOTelLogHandler(logger)}
+}
+
+var (
+	// drain tracks in-flight requests for the shutdown gauges.
+	drain = &drainTracker{}
+
+	// stats counts span outcomes for /debug/tracing.
+	stats = newTracingStats()
 
-	// Create resource
+	// usage reads the process's CPU and memory use for the system usage
+	// gauges and /metrics.
+	usage = newSystemUsage()
+
+	// telemetryResource is the resource initTelemetry attached to the
+	// providers, served by /debug/resource.
+	telemetryResource = resource.Empty()
+
+	// appConfig is the configuration the handlers read; main replaces it
+	// with the parsed and validated configuration before serving.
+	appConfig = LoadConfigFromEnv()
+)
+
+// newResource describes this service, as named by cfg, including the
+// configured global attributes. When cfg.ReleaseID is set it is added so
+// telemetry can be sliced by release.
+func newResource(ctx context.Context, cfg *Config) (*resource.Resource, error) {
 	// Note: K8S node name and other Kubernetes metadata are automatically detected
 	// by the resourcedetection processor in the OpenTelemetry Collector
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("sample-app"),
-			semconv.ServiceVersion("1.0.0"),
-			semconv.DeploymentEnvironment("kubernetes"),
-		),
-	)
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+		semconv.DeploymentEnvironment(cfg.Environment),
+	}
+	attrs = append(attrs, cfg.GlobalAttributes...)
+	if cfg.ReleaseID != "" {
+		attrs = append(attrs, releaseIDKey.String(cfg.ReleaseID))
+	}
+	return resource.New(ctx, resource.WithAttributes(attrs...))
+}
+
+// initTelemetry sets up the OTLP pipelines described by cfg, installs them
+// as the global providers and returns the App recording to them. On error,
+// whatever was already built is shut down and the previous globals are put
+// back.
+func initTelemetry(cfg *Config) (_ *App, err error) {
+	ctx := context.Background()
+
+	if cfg.SDKSelfObservability {
+		if err := enableSDKSelfObservability(); err != nil {
+			return nil, fmt.Errorf("failed to enable SDK self-observability: %w", err)
+		}
+	}
+
+	res, err := newResource(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
+	prevResource := telemetryResource
+	telemetryResource = res
+
+	exp, err := connectExporters(cfg)
+	if err != nil {
+		telemetryResource = prevResource
+		return nil, err
+	}
+
+	// Once created, each provider owns its exporter and shuts it down
+	var tracerProvider *sdktrace.TracerProvider
+	var periodicReader *sdkmetric.PeriodicReader
+	var meterProvider *sdkmetric.MeterProvider
+	a := newDetachedApp()
+	prevTracerProvider, prevMeterProvider, prevPropagator := otel.GetTracerProvider(), otel.GetMeterProvider(), otel.GetTextMapPropagator()
+	prevFlush := exportGate.flush
+	defer func() {
+		if err == nil {
+			return
+		}
+		telemetryResource = prevResource
+		var errs []error
+		if tracerProvider != nil {
+			otel.SetTracerProvider(prevTracerProvider)
+			otel.SetTextMapPropagator(prevPropagator)
+			errs = append(errs, tracerProvider.Shutdown(ctx))
+		} else {
+			errs = append(errs, exp.trace.Shutdown(ctx))
+		}
+		switch {
+		case meterProvider != nil:
+			otel.SetMeterProvider(prevMeterProvider)
+			exportGate.flush = prevFlush
+			errs = append(errs, meterProvider.Shutdown(ctx))
+		case periodicReader != nil:
+			exportGate.flush = prevFlush
+			errs = append(errs, periodicReader.Shutdown(ctx))
+		default:
+			errs = append(errs, exp.metric.Shutdown(ctx))
+		}
+		if a.loggerProvider != nil {
+			errs = append(errs, a.loggerProvider.Shutdown(ctx))
+		} else if exp.log != nil {
+			errs = append(errs, exp.log.Shutdown(ctx))
+		}
+		if serr := errors.Join(errs...); serr != nil {
+			slog.Warn("Failed to shut down telemetry after a failed init", "error", serr)
+		}
+	}()
+
 	// Initialize tracing
-	// Use environment variables for endpoint configuration
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithInsecure(),
-	)
+	sampler, err := newSampler(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create trace exporter: %w", err)
+		return nil, fmt.Errorf("failed to create sampler: %w", err)
 	}
 
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
+	// The export wrappers record to the app's instruments, created below
+	spanProcessor := newSpanProcessor(cfg, readySpanExporter{lastExportSpanExporter{batchSizeSpanExporter{exp.trace, a}, a}})
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(stats.wrap(sampler)),
 		sdktrace.WithResource(res),
-	)
+		sdktrace.WithSpanProcessor(stats),
+	}
+	if len(cfg.GlobalAttributes) > 0 {
+		// The resource already carries these, but backends that flatten
+		// spans only see span attributes
+		providerOpts = append(providerOpts, sdktrace.WithSpanProcessor(
+			newAttributesProcessor(cfg.GlobalAttributes...),
+		))
+	}
+	if cfg.ReleaseID != "" {
+		providerOpts = append(providerOpts, sdktrace.WithSpanProcessor(
+			newRootAttributesProcessor(releaseIDKey.String(cfg.ReleaseID)),
+		))
+	}
+	providerOpts = append(providerOpts, sdktrace.WithSpanProcessor(spanProcessor))
+
+	tracerProvider = sdktrace.NewTracerProvider(providerOpts...)
 	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Keep baggage, such as upstream tenant IDs, alongside the trace context
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
 	// Initialize metrics
-	// Use environment variables for endpoint configuration
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithInsecure(),
+	a.snapshotReader = sdkmetric.NewManualReader()
+	exportGate.buffer = cfg.MetricPauseMode == "buffer"
+	periodicReader = sdkmetric.NewPeriodicReader(pausableMetricExporter{
+		Exporter: readyMetricExporter{lastExportMetricExporter{batchSizeMetricExporter{exp.metric, a}, a}},
+		gate:     exportGate,
+	})
+	exportGate.flush = periodicReader.ForceFlush
+	meterOpts := []sdkmetric.Option{
+		sdkmetric.WithReader(periodicReader),
+		sdkmetric.WithReader(a.snapshotReader),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(durationBucketsView(cfg.DurationBuckets)),
+	}
+	if cfg.PrometheusEnabled {
+		reader, handler, err := newPrometheusReader()
+		if err != nil {
+			return nil, err
+		}
+		meterOpts = append(meterOpts, sdkmetric.WithReader(reader))
+		prometheusHandler = handler
+	}
+	meterProvider = sdkmetric.NewMeterProvider(meterOpts...)
+	otel.SetMeterProvider(meterProvider)
+	if cfg.RuntimeMetricsInterval > 0 {
+		if err := startRuntimeMetrics(meterProvider, cfg.RuntimeMetricsInterval); err != nil {
+			return nil, fmt.Errorf("failed to start runtime metrics: %w", err)
+		}
+	}
+
+	// Initialize logging; without an endpoint logs stay on the console
+	if exp.log != nil {
+		a.loggerProvider = sdklog.NewLoggerProvider(
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(exp.log)),
+			sdklog.WithResource(res),
+		)
+	}
+
+	if err := a.init(tracerProvider, meterProvider); err != nil {
+		return nil, err
+	}
+	go awaitFirstExport(periodicReader.ForceFlush, cfg.TelemetryInitRetryInterval, cfg.TelemetryInitTimeout)
+	telemetryReady.Store(true)
+	return a, nil
+}
+
+// durationBucketsView gives http_request_duration_seconds the explicit
+// bucket boundaries buckets instead of the SDK's defaults.
+func durationBucketsView(buckets []float64) sdkmetric.View {
+	return sdkmetric.NewView(
+		sdkmetric.Instrument{Name: "http_request_duration_seconds"},
+		sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{Boundaries: buckets}},
 	)
-	if err != nil {
-		return fmt.Errorf("failed to create metric exporter: %w", err)
+}
+
+// startRuntimeMetrics records the Go runtime's memory, goroutine and GC
+// metrics, such as go.memory.used and go.goroutine.count, to mp, reading
+// the runtime's memory statistics at most once per interval.
+func startRuntimeMetrics(mp metric.MeterProvider, interval time.Duration) error {
+	return otelruntime.Start(
+		otelruntime.WithMeterProvider(mp),
+		otelruntime.WithMinimumReadMemStatsInterval(interval),
+	)
+}
+
+// sdkSelfObservabilityEnv is the SDK's experimental switch for metrics
+// about itself.
+const sdkSelfObservabilityEnv = "OTEL_GO_X_SELF_OBSERVABILITY"
+
+// enableSDKSelfObservability turns on the SDK's self-observability metrics
+// for the providers and processors created afterwards; the SDK only reads
+// the switch from the environment. The instruments come from the global
+// meter provider, so they are exported with the app's metrics.
+//
+// It sets OTEL_GO_X_SELF_OBSERVABILITY in the process environment, so the
+// switch also applies to child processes and stays on for any providers
+// created later in the process, including after a failed init.
+func enableSDKSelfObservability() error {
+	return os.Setenv(sdkSelfObservabilityEnv, "true")
+}
+
+// shutdownProviders flushes and stops both providers. Both are always shut
+// down, and each error is labeled with its pipeline before they are joined,
+// so a failing metric flush does not hide how the trace flush went.
+func shutdownProviders(ctx context.Context, tp *sdktrace.TracerProvider, mp *sdkmetric.MeterProvider) error {
+	var errs []error
+	if err := tp.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("traces pipeline shutdown: %w", err))
 	}
+	if err := mp.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("metrics pipeline shutdown: %w", err))
+	}
+	return errors.Join(errs...)
+}
 
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
-		sdkmetric.WithResource(res),
+// emitStartupSpan records a single span summarizing the effective
+// configuration so deploys are searchable in the trace backend, and logs
+// where telemetry is exported to. Credentials in the endpoint URLs are
+// redacted from both.
+func (a *App) emitStartupSpan(ctx context.Context, cfg *Config) {
+	ctx, span := a.tracer.Start(ctx, "startup", trace.WithAttributes(cfg.Attributes()...))
+	slog.InfoContext(ctx, "Exporting telemetry",
+		"trace_endpoint", redactURL(cfg.TraceEndpoint),
+		"metric_endpoint", redactURL(cfg.MetricEndpoint),
+		"log_endpoint", redactURL(cfg.LogEndpoint),
 	)
-	otel.SetMeterProvider(meterProvider)
+	span.End()
+}
 
-	// Get tracer and meter
-	tracer = otel.Tracer("sample-app", trace.WithInstrumentationVersion("1.0.0"))
-	meter = otel.Meter("sample-app", metric.WithInstrumentationVersion("1.0.0"))
+// initInstruments creates the metric instruments used by the handlers from
+// a's meter.
+func (a *App) initInstruments() error {
+	// New instruments start without any recorded series or cached work
+	a.series = newSeriesTracker()
+	a.workCache = newIdempotencyCache(idempotencyTTL, idempotencyMaxEntries)
 
-	// Create metrics
-	requestCounter, err = meter.Int64Counter(
+	var err error
+	a.requestCounter, err = a.meter.Int64Counter(
 		"http_requests_total",
 		metric.WithDescription("Total number of HTTP requests"),
 	)
@@ -91,7 +417,7 @@ func initTelemetry() error {
 		return fmt.Errorf("failed to create counter: %w", err)
 	}
 
-	requestDuration, err = meter.Float64Histogram(
+	a.requestDuration, err = a.meter.Float64Histogram(
 		"http_request_duration_seconds",
 		metric.WithDescription("HTTP request duration in seconds"),
 	)
@@ -99,139 +425,669 @@ func initTelemetry() error {
 		return fmt.Errorf("failed to create histogram: %w", err)
 	}
 
+	a.recordErrors, err = a.meter.Int64Counter(
+		"metric_record_errors_total",
+		metric.WithDescription("Total number of measurements skipped because their value was invalid"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create record error counter: %w", err)
+	}
+
+	a.cancelledCounter, err = a.meter.Int64Counter(
+		"http_requests_cancelled_total",
+		metric.WithDescription("Total number of HTTP requests abandoned by the client before completion"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cancellation counter: %w", err)
+	}
+
+	a.preflightCounter, err = a.meter.Int64Counter(
+		"http_preflight_requests_total",
+		metric.WithDescription("Total number of OPTIONS requests answered with the route's allowed methods"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create preflight counter: %w", err)
+	}
+
+	a.throttledCounter, err = a.meter.Int64Counter(
+		"http_requests_throttled_total",
+		metric.WithDescription("Total number of HTTP requests shed with 429 Too Many Requests"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create throttled counter: %w", err)
+	}
+
+	a.missingTraceCounter, err = a.meter.Int64Counter(
+		"http_requests_missing_trace_total",
+		metric.WithDescription("Total number of HTTP requests that arrived without a valid incoming trace context"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create missing trace counter: %w", err)
+	}
+
+	a.workItemsCounter, err = a.meter.Int64Counter(
+		"work_items_total",
+		metric.WithDescription("Total number of simulated work items by work type"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create work items counter: %w", err)
+	}
+
+	a.exportBatchSize, err = a.meter.Int64Histogram(
+		"otlp_export_batch_size",
+		metric.WithDescription("Number of spans or metrics per OTLP export"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create export batch size histogram: %w", err)
+	}
+
+	a.downstreamWait, err = a.meter.Float64Histogram(
+		"downstream_wait_duration_seconds",
+		metric.WithDescription("Time downstream calls waited for a concurrency slot in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create downstream wait histogram: %w", err)
+	}
+
+	a.spansPerRequest, err = a.meter.Int64Histogram(
+		"spans_per_request",
+		metric.WithDescription("Number of spans started under each request span"),
+		metric.WithUnit("{span}"),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 4, 8, 16, 32, 64, 128),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create spans per request histogram: %w", err)
+	}
+
+	if err := registerGauge("series gauge", func() error { return registerSeriesGauge(a.meter, a.series) }); err != nil {
+		return err
+	}
+
+	if err := registerGauge("shutdown gauges", func() error { return registerDrainGauges(a.meter, drain) }); err != nil {
+		return err
+	}
+
+	if err := registerGauge("export age gauge", func() error { return registerExportAgeGauge(a.meter, &a.lastExport) }); err != nil {
+		return err
+	}
+
+	if err := registerGauge("sample rate gauge", func() error { return registerSampleRateGauge(a.meter, stats) }); err != nil {
+		return err
+	}
+
+	if err := registerGauge("system usage gauges", func() error { return registerSystemUsageGauges(a.meter, usage) }); err != nil {
+		return err
+	}
+
+	a.quantiles = nil
+	if appConfig.DurationQuantileWindow > 0 {
+		a.quantiles = newQuantileEstimator(appConfig.DurationQuantileWindow)
+		if err := registerGauge("quantile gauges", func() error { return registerQuantileGauges(a.meter, a.quantiles) }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerGauge runs register for the observable gauges called name. They
+// are not needed to serve requests, so a failure is logged and skipped
+// unless Config.RequireGauges makes it fatal.
+func registerGauge(name string, register func() error) error {
+	err := register()
+	if err == nil {
+		return nil
+	}
+	if appConfig.RequireGauges {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	slog.Warn("Skipping gauges that failed to register", "gauges", name, "error", err)
 	return nil
 }
 
-func simulateWork(ctx context.Context) {
+// recordDuration records seconds on requestDuration unless the value is NaN,
+// infinite or negative, in which case it is skipped and counted in
+// recordErrors instead of being silently dropped by the SDK. Measurements for
+// endpoints with the histogram disabled are skipped entirely. With
+// Config.TenantMetricKey, measurements are labelled with the request's tenant.
+func (a *App) recordDuration(ctx context.Context, seconds float64, attrs ...attribute.KeyValue) {
+	endpoint := ""
+	for _, attr := range attrs {
+		if attr.Key == "endpoint" {
+			endpoint = attr.Value.AsString()
+		}
+	}
+	if !appConfig.histogramEnabled(endpoint) {
+		return
+	}
+
+	reason := ""
+	switch {
+	case math.IsNaN(seconds):
+		reason = "nan"
+	case math.IsInf(seconds, 0):
+		reason = "inf"
+	case seconds < 0:
+		reason = "negative"
+	}
+	if reason != "" {
+		a.countRecordError(ctx,
+			attribute.String("instrument", "http_request_duration_seconds"),
+			attribute.String("reason", reason),
+		)
+		return
+	}
+	attrs = append(attrs, tenantMetricAttributes(ctx)...)
+	a.series.observe("http_request_duration_seconds", attrs...)
+	a.requestDuration.Record(ctx, seconds, metric.WithAttributes(attrs...))
+	if a.quantiles != nil {
+		a.quantiles.observe(endpoint, seconds)
+	}
+}
+
+// countRecordError increments recordErrors with the configured default
+// attributes merged in; attrs win over a default with the same key.
+func (a *App) countRecordError(ctx context.Context, attrs ...attribute.KeyValue) {
+	merged := append(slices.Clone(appConfig.ErrorCounterAttributes), attrs...)
+	a.recordErrors.Add(ctx, 1, metric.WithAttributes(merged...))
+}
+
+// countRequest increments requestCounter with attrs, labelled with the
+// experiment variant startServerSpan found for the request and, with
+// Config.TenantMetricKey, its tenant.
+func (a *App) countRequest(ctx context.Context, attrs ...attribute.KeyValue) {
+	if variant, ok := experimentVariant(ctx); ok {
+		attrs = append(attrs, experimentVariantKey.String(variant))
+	}
+	attrs = append(attrs, tenantMetricAttributes(ctx)...)
+	a.series.observe("http_requests_total", attrs...)
+	a.requestCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// randSource is the subset of *rand.Rand used to drive simulated latency and
+// errors, so a request can swap the shared source for a seeded one.
+type randSource interface {
+	Intn(n int) int
+	Float64() float64
+}
+
+// lockedRand is a *rand.Rand safe for use by concurrent handlers.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// seedRand replaces a's random source with one seeded by seed, so the
+// sequence of simulated latencies and errors is reproducible.
+// Production keeps the time-seeded source newApp installs; tests pass a
+// fixed seed.
+func (a *App) seedRand(seed int64) {
+	a.rng = newLockedRand(seed)
+}
+
+// requestRand returns the random source for r: a request-local RNG when the
+// request carries a ?seed=N query parameter, otherwise a's shared source.
+func (a *App) requestRand(r *http.Request) (randSource, error) {
+	raw := r.URL.Query().Get("seed")
+	if raw == "" {
+		return a.rng, nil
+	}
+	seed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed %q: must be an integer", raw)
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+// workLatency picks a simulated work duration: at least the configured floor
+// plus a random portion up to the configured maximum.
+func workLatency(rng randSource) time.Duration {
+	d := appConfig.MinWorkLatency
+	if spread := (appConfig.MaxWorkLatency - appConfig.MinWorkLatency).Milliseconds(); spread > 0 {
+		d += time.Duration(rng.Intn(int(spread))) * time.Millisecond
+	}
+	return d
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx.Err() in the
+// latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// workRequest is the work a /work request asks for. POST requests may set
+// it in a JSON body; otherwise ?type= selects the work type and
+// ?duration_ms= its latency.
+type workRequest struct {
+	Type       string `json:"type"`
+	DurationMS *int64 `json:"duration_ms"`
+}
+
+// parseWorkRequest reads the work request from r, filling in a work type
+// drawn from rng when none is requested.
+func parseWorkRequest(w http.ResponseWriter, r *http.Request, rng randSource) (workRequest, error) {
+	var req workRequest
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			return req, err
+		}
+	}
+	if req.Type == "" {
+		req.Type = r.URL.Query().Get("type")
+	}
+	if v := r.URL.Query().Get("duration_ms"); req.DurationMS == nil && v != "" {
+		d, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("invalid duration_ms %q: must be an integer", v)
+		}
+		req.DurationMS = &d
+	}
+
+	var err error
+	if req.Type, err = pickWorkType(req.Type, rng); err != nil {
+		return req, err
+	}
+	if d := req.DurationMS; d != nil && (*d < 0 || *d > appConfig.MaxWorkLatency.Milliseconds()) {
+		return req, fmt.Errorf("invalid duration_ms %d: must be between 0 and %d", *d, appConfig.MaxWorkLatency.Milliseconds())
+	}
+	return req, nil
+}
+
+// pickWorkType returns requested when it names a configured work type, or
+// one drawn from rng when requested is empty.
+func pickWorkType(requested string, rng randSource) (string, error) {
+	types := appConfig.WorkTypes
+	if requested != "" {
+		if !slices.Contains(types, requested) {
+			return "", fmt.Errorf("invalid work type %q: must be one of %s", requested, strings.Join(types, ", "))
+		}
+		return requested, nil
+	}
+	if len(types) == 1 {
+		return types[0], nil
+	}
+	return types[rng.Intn(len(types))], nil
+}
+
+// errSimulatedFailure is the error recorded on spans whose simulated work
+// failed.
+var errSimulatedFailure = errors.New("simulated work failure")
+
+// simulateWork sleeps for workDuration, returning ctx.Err() early with the
+// span marked cancelled if ctx ends first.
+func (a *App) simulateWork(ctx context.Context, rng randSource, workType string, workDuration time.Duration) error {
 	span := trace.SpanFromContext(ctx)
 
 	// Simulate some work
-	workDuration := time.Duration(rand.Intn(500)) * time.Millisecond
-	time.Sleep(workDuration)
+	if err := sleepContext(ctx, workDuration); err != nil {
+		span.SetAttributes(attribute.Bool("cancelled", true))
+		span.SetStatus(codes.Error, "cancelled")
+		return err
+	}
 
 	span.SetAttributes(
-		attribute.String("work.type", "processing"),
+		attribute.String("work.type", workType),
 		attribute.Int("work.duration_ms", int(workDuration.Milliseconds())),
 	)
 
-	// Sometimes simulate an error
-	if rand.Intn(10) == 0 {
+	attrs := attribute.String("work.type", workType)
+	a.series.observe("work_items_total", attrs)
+	a.workItemsCounter.Add(ctx, 1, metric.WithAttributes(attrs))
+
+	// Sometimes simulate an error, marking the span failed so it stands
+	// out in trace waterfalls
+	if rng.Float64() < appConfig.NestedErrorRate {
 		span.SetAttributes(attribute.Bool("error", true))
-		log.Printf("Simulated error occurred")
+		span.AddEvent("simulated_failure",
+			trace.WithTimestamp(time.Now()),
+			trace.WithAttributes(attribute.String("work.type", workType)),
+		)
+		span.RecordError(errSimulatedFailure)
+		span.SetStatus(codes.Error, errSimulatedFailure.Error())
+		slog.WarnContext(ctx, "Simulated error occurred")
 	}
+	return nil
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, span := tracer.Start(r.Context(), "health_check")
-	defer span.End()
-
-	start := time.Now()
-
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/health"),
-		attribute.String("status", "200"),
-	))
-
+// healthHandler is served through withTelemetry.
+func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
-
-	duration := time.Since(start).Seconds()
-	requestDuration.Record(ctx, duration, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/health"),
-	))
 }
 
-func workHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, span := tracer.Start(r.Context(), "do_work")
-	defer span.End()
+// workHandler is served through withTelemetry.
+func (a *App) workHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	rng, err := a.requestRand(r)
+	var req workRequest
+	if err == nil {
+		req, err = parseWorkRequest(w, r, rng)
+	}
+	if err != nil {
+		span.SetAttributes(attribute.Bool("error", true))
+		span.RecordError(err)
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 
-	start := time.Now()
+	if req.DurationMS != nil {
+		span.SetAttributes(attribute.Int64("work.requested_duration_ms", *req.DurationMS))
+	}
+
+	// Shed load before doing any work
+	if rate := appConfig.ThrottleRate; rate > 0 && rng.Float64() < rate {
+		a.throttle(ctx, w)
+		return
+	}
 
 	// Add some attributes
 	span.SetAttributes(
-		attribute.String("user.id", "user-"+strconv.Itoa(rand.Intn(100))),
-		attribute.String("request.id", fmt.Sprintf("req-%d", rand.Intn(10000))),
+		attribute.String("user.id", "user-"+strconv.Itoa(rng.Intn(100))),
+		attribute.String("request.id", fmt.Sprintf("req-%d", rng.Intn(10000))),
 	)
 
-	// Simulate nested work
-	childCtx, childSpan := tracer.Start(ctx, "nested_operation")
-	simulateWork(childCtx)
-	childSpan.End()
+	// Replay the stored response for a retried idempotency key
+	key := r.Header.Get(idempotencyKeyHeader)
+	cached, hit := cachedResponse{}, false
+	if key != "" {
+		cached, hit = a.workCache.get(key)
+		span.SetAttributes(attribute.Bool("cache.hit", hit))
+	}
 
-	status := "200"
-	if rand.Intn(20) == 0 { // 5% error rate
-		status = "500"
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Internal Server Error"))
-		span.SetAttributes(attribute.Bool("error", true))
-	} else {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Work completed successfully"))
+	status, body := cached.status, cached.body
+	if !hit {
+		res, shared := a.runWork(ctx, key, rng, req)
+		status, body = res.status, res.body
+		if shared {
+			span.SetAttributes(attribute.Bool("work.coalesced", true))
+		}
+		if status != http.StatusOK {
+			span.SetAttributes(attribute.Bool("error", true))
+		}
 	}
 
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/work"),
-		attribute.String("status", status),
-	))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// throttle answers r with 429 Too Many Requests and a Retry-After of
+// Config.ThrottleRetryAfter in whole seconds, recording the rejection on the
+// request span and in throttledCounter.
+func (a *App) throttle(ctx context.Context, w http.ResponseWriter) {
+	retryAfter := int(math.Ceil(appConfig.ThrottleRetryAfter.Seconds()))
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("throttled", true),
+		attribute.Int("http.retry_after", retryAfter),
+	)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 
-	duration := time.Since(start).Seconds()
-	requestDuration.Record(ctx, duration, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/work"),
-	))
+	a.throttledCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("endpoint", "/work")))
 }
 
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, span := tracer.Start(r.Context(), "metrics")
-	defer span.End()
+// runWork performs the simulated /work and stores its response under the
+// idempotency key, if any. Config.WorkDeadline bounds the nested work and
+// the downstream call with its retries; work cut short by it or by a
+// disconnected client is answered with 504 or 499 and not stored. With
+// Config.CoalesceWork, concurrent requests with the same key share one
+// execution, reported by shared. That execution is detached from the
+// cancellation of the request that started it, so its followers are not
+// answered 499 when that client goes away.
+func (a *App) runWork(ctx context.Context, key string, rng randSource, req workRequest) (res cachedResponse, shared bool) {
+	coalesce := key != "" && appConfig.CoalesceWork
+	parent := ctx
+	if coalesce {
+		parent = context.WithoutCancel(ctx)
+	}
+
+	work := func() (any, error) {
+		latency := workLatency(rng)
+		if req.DurationMS != nil {
+			latency = time.Duration(*req.DurationMS) * time.Millisecond
+		}
 
-	start := time.Now()
+		// Simulate nested work, giving up at the deadline or when the
+		// client goes away
+		workCtx, cancel := context.WithTimeout(parent, appConfig.WorkDeadline)
+		defer cancel()
+		childCtx, childSpan := a.tracer.Start(workCtx, "nested_operation", trace.WithAttributes(baggageAttributes(ctx)...))
+		err := a.simulateWork(childCtx, rng, req.Type, latency)
+		childSpan.End()
+		if err != nil {
+			return cutShort(err), nil
+		}
 
-	// Generate some random metrics
-	cpuUsage := rand.Float64() * 100
-	memoryUsage := rand.Float64() * 1024 * 1024 * 1024 // GB
+		if url := appConfig.DownstreamURL; url != "" {
+			err := a.retry(workCtx, appConfig.DownstreamRetries, appConfig.DownstreamRetryBackoff, func(ctx context.Context) error {
+				return a.callDownstream(ctx, url)
+			})
+			if err != nil {
+				slog.WarnContext(workCtx, "Downstream call failed", "error", err)
+			}
+			if err := workCtx.Err(); err != nil {
+				return cutShort(err), nil
+			}
+		}
+
+		res := cachedResponse{status: http.StatusOK, body: []byte("Work completed successfully")}
+		if rng.Float64() < errorRate.Load() {
+			res = cachedResponse{status: http.StatusInternalServerError, body: []byte("Internal Server Error")}
+		}
+
+		if key != "" {
+			a.workCache.set(key, res.status, res.body)
+		}
+		return res, nil
+	}
+
+	if !coalesce {
+		v, _ := work()
+		return v.(cachedResponse), false
+	}
+	v, _, shared := a.workGroup.Do(key, work)
+	return v.(cachedResponse), shared
+}
+
+// cutShort returns the response for work stopped by err: 504 when the work
+// deadline passed, 499 when the client went away.
+func cutShort(err error) cachedResponse {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return cachedResponse{status: http.StatusGatewayTimeout, body: []byte("Work deadline exceeded")}
+	}
+	return cachedResponse{status: statusClientClosedRequest, body: []byte("Client Closed Request")}
+}
+
+// statusClientClosedRequest is the non-standard status recorded when the
+// client goes away before the response is written.
+const statusClientClosedRequest = 499
+
+// cancellableHandler simulates work that stops as soon as the client
+// disconnects, recording the cancellation on the span and in
+// a.cancelledCounter.
+func (a *App) cancellableHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	if err := sleepContext(ctx, workLatency(a.rng)); err != nil {
+		span.SetAttributes(attribute.Bool("cancelled", true))
+		span.SetStatus(codes.Error, "cancelled")
+		a.cancelledCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("method", r.Method),
+			attribute.String("endpoint", "/cancellable"),
+		))
+		// The client is gone; the status is only for withTelemetry
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Work completed successfully"))
+}
+
+// metricsHandler is served through withTelemetry, which counts the request
+// once the response is written, so the snapshot does not include it.
+func (a *App) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	// Report the values the system usage gauges observe
+	cpuUsage, memoryUsage := usage.read()
 
 	span.SetAttributes(
 		attribute.Float64("system.cpu.usage", cpuUsage),
 		attribute.Float64("system.memory.usage", memoryUsage),
 	)
 
-	requestCounter.Add(ctx, 1, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/metrics"),
-		attribute.String("status", "200"),
-	))
+	instruments := []instrumentSnapshot{}
+	if a.snapshotReader != nil {
+		snap, err := snapshotMetrics(ctx, a.snapshotReader)
+		if err != nil {
+			span.RecordError(err)
+			slog.WarnContext(ctx, "failed to snapshot metrics", "error", err)
+		} else {
+			instruments = snap
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"cpu_usage": %.2f, "memory_usage": %.2f}`, cpuUsage, memoryUsage)
-
-	duration := time.Since(start).Seconds()
-	requestDuration.Record(ctx, duration, metric.WithAttributes(
-		attribute.String("method", r.Method),
-		attribute.String("endpoint", "/metrics"),
-	))
+	json.NewEncoder(w).Encode(struct {
+		CPUUsage    float64              `json:"cpu_usage"`
+		MemoryUsage float64              `json:"memory_usage"`
+		Instruments []instrumentSnapshot `json:"instruments"`
+	}{cpuUsage, memoryUsage, instruments})
 }
 
 func main() {
-	if err := initTelemetry(); err != nil {
-		log.Fatalf("Failed to initialize telemetry: %v", err)
+	cfg := LoadConfigFromEnv()
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	appConfig = cfg
+	errorRate.Store(cfg.ErrorRate)
+
+	// Route logs through a handler that correlates them with the active span
+	var console slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	if cfg.LogFormat == "json" {
+		console = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(newTraceHandler(console)))
+
+	app, err := initTelemetry(cfg)
+	if err != nil {
+		if cfg.TelemetryFailureMode != "degraded" {
+			log.Fatalf("Failed to initialize telemetry: %v", err)
+		}
+		slog.Error("Failed to initialize telemetry", "error", err)
+		serveDegraded(cfg, err)
+		return
 	}
+	slog.SetDefault(slog.New(app.logHandler(slog.Default().Handler())))
+	app.emitStartupSpan(context.Background(), cfg)
 
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/work", workHandler)
-	http.HandleFunc("/metrics", metricsHandler)
+	if cfg.CardinalityReportInterval > 0 {
+		go reportCardinality(context.Background(), slog.Default(), app.series, cfg.CardinalityReportInterval)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	http.HandleFunc("/health", app.withTelemetry("/health", "health_check", app.healthHandler))
+	http.HandleFunc("/ready", readyHandler)
+	http.HandleFunc("/work", app.withTelemetry("/work", "do_work", app.workHandler))
+	http.HandleFunc("/metrics", app.withTelemetry("/metrics", "metrics", app.metricsHandler))
+	http.HandleFunc("/cancellable", app.withTelemetry("/cancellable", "cancellable_work", app.cancellableHandler))
+	http.HandleFunc("/batch", app.withTelemetry("/batch", "batch", app.batchHandler))
+	http.HandleFunc("/admin/memspike", app.withTelemetry("/admin/memspike", "memspike", requireAdmin(app.memSpikeHandler)))
+	http.HandleFunc("/admin/flags", requireAdmin(app.flagsHandler))
+	http.HandleFunc("/admin/metrics/pause", requireAdmin(metricsPauseHandler))
+	http.HandleFunc("/debug/tracing", debugTracingHandler)
+	http.HandleFunc("/debug/resource", resourceHandler)
+	http.HandleFunc("/debug/propagation", propagationHandler)
+	if cfg.PrometheusEnabled {
+		http.Handle("/prometheus", prometheusHandler)
 	}
 
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	// SIGHUP reloads the error rate so chaos drills can change it live
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloadErrorRate(cfg); err != nil {
+				slog.Error("Failed to reload error rate", "error", err)
+			}
+		}
+	}()
+
+	ln, err := listen(cfg)
+	if err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+
+	srv := &http.Server{Handler: app.serverHandler(cfg, http.DefaultServeMux)}
+
+	// SIGINT and SIGTERM drain in-flight requests before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		stop()
+		slog.Info("Shutting down, draining requests", "timeout", cfg.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownServer(ctx, srv, drain); err != nil {
+			slog.Error("Failed to drain requests", "error", err)
+		}
+		close(drained)
+	}()
+
+	slog.Info("Starting server", "addr", ln.Addr().String())
+	if err := serve(cfg, srv, ln); !errors.Is(err, http.ErrServerClosed) {
+		flushTelemetry(app)
+		log.Fatalf("Server failed: %v", err)
+	}
+	<-drained
+
+	flushTelemetry(app)
+}
+
+// flushTelemetry shuts down app's providers, exporting pending spans and the
+// final metrics, within telemetryShutdownTimeout.
+func flushTelemetry(app *App) {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+	defer cancel()
+	if err := app.shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down telemetry", "error", err)
+	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// defaultRouteMethods is the method allowlist of the routes the app serves.
+const defaultRouteMethods = "/health=GET,/work=GET|POST,/metrics=GET,/batch=GET,/cancellable=GET"
+
+// parseRouteMethods parses comma-separated route=METHOD|METHOD entries,
+// e.g. "/work=GET|POST,/health=GET".
+func parseRouteMethods(v string) (map[string][]string, error) {
+	routes := make(map[string][]string)
+	for _, entry := range splitList(v) {
+		route, list, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid route methods %q: must be route=METHOD|METHOD", entry)
+		}
+		var methods []string
+		for _, method := range strings.Split(list, "|") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if method == "" {
+				return nil, fmt.Errorf("invalid route methods %q: empty method", entry)
+			}
+			if !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+		routes[route] = methods
+	}
+	return routes, nil
+}
+
+// formatRouteMethods renders routes in the form parseRouteMethods accepts,
+// sorted by route.
+func formatRouteMethods(routes map[string][]string) string {
+	entries := make([]string, 0, len(routes))
+	for route, methods := range routes {
+		entries = append(entries, route+"="+strings.Join(methods, "|"))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// allowMethods restricts the routes in Config.RouteMethods to their listed
+// methods before handing requests to next; HEAD is allowed wherever GET is,
+// as net/http serves it with the GET handler. OPTIONS is answered with 204
+// No Content and an Allow header listing them, plus the CORS
+// Access-Control-Allow-Methods header for preflights, and also counted in
+// preflightCounter. Other methods get 405 Method Not Allowed. Both answers
+// are served through withTelemetry like the routes themselves. Routes
+// without an allowlist accept every method. Except in "strict"
+// trailingSlash mode, a path such as /work/ is held to /work's allowlist.
+func (a *App) allowMethods(routes map[string][]string, trailingSlash string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if route != "/" && trailingSlash != "strict" {
+			route = strings.TrimRight(route, "/")
+		}
+		methods, ok := routes[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		methods = withHead(methods)
+		if slices.Contains(methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allow := strings.Join(append(methods, http.MethodOptions), ", ")
+		w.Header().Set("Allow", allow)
+		if r.Method != http.MethodOptions {
+			a.withTelemetry(route, "method_not_allowed", func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			})(w, r)
+			return
+		}
+
+		a.withTelemetry(route, "options", func(w http.ResponseWriter, r *http.Request) {
+			preflight := r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", allow)
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+			a.preflightCounter.Add(r.Context(), 1, metric.WithAttributes(
+				attribute.String("endpoint", route),
+				attribute.Bool("cors", preflight),
+			))
+		})(w, r)
+	})
+}
+
+// withHead returns a copy of methods with HEAD added after GET, unless GET
+// is missing or HEAD is already listed.
+func withHead(methods []string) []string {
+	i := slices.Index(methods, http.MethodGet)
+	if i < 0 || slices.Contains(methods, http.MethodHead) {
+		return slices.Clone(methods)
+	}
+	return slices.Insert(slices.Clone(methods), i+1, http.MethodHead)
+}
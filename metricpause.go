@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// metricExportGate pauses metric exports at runtime, e.g. during collector
+// maintenance windows, without restarting the app.
+type metricExportGate struct {
+	paused  atomic.Bool
+	skipped atomic.Int64
+
+	// buffer makes resume flush immediately when exports were skipped. The
+	// exporter keeps cumulative temporality, so one export carries
+	// everything recorded during the pause. Otherwise counters and
+	// histograms are exported as deltas, so what was recorded during the
+	// pause is dropped with the skipped collections.
+	buffer bool
+	// flush exports the current collection; initTelemetry sets it to the
+	// periodic reader's ForceFlush.
+	flush func(context.Context) error
+}
+
+// exportGate gates the periodic metric exports initTelemetry sets up.
+var exportGate = &metricExportGate{}
+
+// pause stops exports until resume is called.
+func (g *metricExportGate) pause() {
+	g.paused.Store(true)
+}
+
+// resume restarts exports, flushing first in buffer mode if any export was
+// skipped while paused.
+func (g *metricExportGate) resume(ctx context.Context) error {
+	if !g.paused.Swap(false) {
+		return nil
+	}
+	if g.skipped.Swap(0) > 0 && g.buffer && g.flush != nil {
+		return g.flush(ctx)
+	}
+	return nil
+}
+
+// pausableMetricExporter skips exports while its gate is paused. The gate's
+// mode must be set before the exporter is handed to a reader.
+type pausableMetricExporter struct {
+	sdkmetric.Exporter
+	gate *metricExportGate
+}
+
+// Temporality reports delta temporality for counters and histograms unless
+// the gate buffers, so a skipped export's samples are not carried into the
+// next one. Up-down counters describe a current level and stay cumulative.
+func (e pausableMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	if e.gate.buffer {
+		return e.Exporter.Temporality(k)
+	}
+	switch k {
+	case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram, sdkmetric.InstrumentKindObservableCounter:
+		return metricdata.DeltaTemporality
+	}
+	return metricdata.CumulativeTemporality
+}
+
+func (e pausableMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.gate.paused.Load() {
+		e.gate.skipped.Add(1)
+		return nil
+	}
+	return e.Exporter.Export(ctx, rm)
+}
+
+// metricsPauseHandler reports whether metric exports are paused as JSON. A
+// POST with paused=true or paused=false pauses or resumes them.
+func metricsPauseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		paused, err := strconv.ParseBool(r.FormValue("paused"))
+		if err != nil {
+			http.Error(w, "paused must be true or false", http.StatusBadRequest)
+			return
+		}
+		if paused {
+			exportGate.pause()
+			slog.InfoContext(r.Context(), "Paused metric exports")
+		} else {
+			if err := exportGate.resume(r.Context()); err != nil {
+				slog.WarnContext(r.Context(), "Metric flush on resume failed", "error", err)
+			}
+			slog.InfoContext(r.Context(), "Resumed metric exports")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"paused":          exportGate.paused.Load(),
+		"skipped_exports": exportGate.skipped.Load(),
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricsPauseToggle(t *testing.T) {
+	tests := []struct {
+		name              string
+		buffer            bool
+		wantAfterResume   int64
+		wantAfterNextTick int64
+		// wantExported is the counter value in the export after resume
+		wantExported int64
+	}{
+		{
+			name:              "drop loses what was recorded while paused",
+			buffer:            false,
+			wantAfterResume:   0,
+			wantAfterNextTick: 1,
+			wantExported:      1,
+		},
+		{
+			name:              "buffer flushes on resume",
+			buffer:            true,
+			wantAfterResume:   1,
+			wantAfterNextTick: 2,
+			wantExported:      4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, func(c *Config) { c.AdminToken = "s3cret" })
+
+			exporter := &sumMetricExporter{}
+			gate := &metricExportGate{buffer: tt.buffer}
+			reader := sdkmetric.NewPeriodicReader(pausableMetricExporter{Exporter: exporter, gate: gate})
+			gate.flush = reader.ForceFlush
+			provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			defer provider.Shutdown(context.Background())
+
+			orig := exportGate
+			exportGate = gate
+			t.Cleanup(func() { exportGate = orig })
+
+			counter, err := provider.Meter("test").Int64Counter("pause_test_total")
+			if err != nil {
+				t.Fatalf("Failed to create counter: %v", err)
+			}
+
+			toggle := func(paused string) {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodPost, "/admin/metrics/pause?paused="+paused, nil)
+				req.Header.Set("Authorization", "Bearer s3cret")
+				w := httptest.NewRecorder()
+				requireAdmin(metricsPauseHandler)(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected status %d setting paused=%s, got %d: %s", http.StatusOK, paused, w.Code, w.Body.String())
+				}
+			}
+
+			toggle("true")
+			for i := 0; i < 3; i++ {
+				counter.Add(context.Background(), 1)
+				reader.ForceFlush(context.Background())
+			}
+			if got := exporter.exports.Load(); got != 0 {
+				t.Fatalf("Expected no exports while paused, got %d", got)
+			}
+
+			toggle("false")
+			if got := exporter.exports.Load(); got != tt.wantAfterResume {
+				t.Errorf("Expected %d exports right after resume, got %d", tt.wantAfterResume, got)
+			}
+
+			counter.Add(context.Background(), 1)
+			reader.ForceFlush(context.Background())
+			if got := exporter.exports.Load(); got != tt.wantAfterNextTick {
+				t.Errorf("Expected %d exports after the next export, got %d", tt.wantAfterNextTick, got)
+			}
+			if got := exporter.sum.Load(); got != tt.wantExported {
+				t.Errorf("Expected pause_test_total %d in the last export, got %d", tt.wantExported, got)
+			}
+		})
+	}
+}
+
+// sumMetricExporter counts exports like stubMetricExporter and keeps the
+// value of the last int64 sum exported.
+type sumMetricExporter struct {
+	stubMetricExporter
+	sum atomic.Int64
+}
+
+func (e *sumMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && len(sum.DataPoints) > 0 {
+				e.sum.Store(sum.DataPoints[0].Value)
+			}
+		}
+	}
+	return e.stubMetricExporter.Export(ctx, rm)
+}
+
+func TestMetricsPauseRejectsInvalidValue(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/admin/metrics/pause?paused=maybe", nil)
+	w := httptest.NewRecorder()
+	metricsPauseHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
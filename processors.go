@@ -0,0 +1,439 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newSpanProcessor builds the processor chain that feeds exporter: the
+// export processor selected by cfg.SpanProcessor, wrapped by the optional
+// processors that adjust spans on their way out.
+func newSpanProcessor(cfg *Config, exporter sdktrace.SpanExporter) sdktrace.SpanProcessor {
+	var processor sdktrace.SpanProcessor
+	if cfg.SpanProcessor == "simple" {
+		// Exports synchronously as each span ends; for debugging only
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	} else {
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	}
+
+	if cfg.DropHealthySpans {
+		processor = newDropProcessor(processor, successfulHealthCheck)
+	}
+	if cfg.GCPauseEvents {
+		processor = newGCPauseProcessor(processor)
+	}
+	if cfg.MaxSpansPerTrace > 0 {
+		processor = newSpanCapProcessor(processor, cfg.MaxSpansPerTrace)
+	}
+	if cfg.MaxAttributeValueLength > 0 {
+		processor = newTruncatingProcessor(processor, cfg.MaxAttributeValueLength)
+	}
+	if len(cfg.SensitiveAttributeKeys) > 0 {
+		processor = newRedactingProcessor(processor, cfg.SensitiveAttributeKeys, cfg.RedactionMode)
+	}
+	return processor
+}
+
+// releaseIDKey identifies the deployed release on the resource and on root spans.
+const releaseIDKey = attribute.Key("release.id")
+
+// attributesProcessor stamps fixed attributes onto spans as they start. When
+// rootOnly is set only local root spans, those without a parent in this
+// process, are annotated.
+type attributesProcessor struct {
+	attrs    []attribute.KeyValue
+	rootOnly bool
+}
+
+func newAttributesProcessor(attrs ...attribute.KeyValue) *attributesProcessor {
+	return &attributesProcessor{attrs: attrs}
+}
+
+func newRootAttributesProcessor(attrs ...attribute.KeyValue) *attributesProcessor {
+	return &attributesProcessor{attrs: attrs, rootOnly: true}
+}
+
+func (p *attributesProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if p.rootOnly && !isLocalRoot(s.Parent()) {
+		return
+	}
+	s.SetAttributes(p.attrs...)
+}
+
+func (p *attributesProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (p *attributesProcessor) Shutdown(context.Context) error   { return nil }
+func (p *attributesProcessor) ForceFlush(context.Context) error { return nil }
+
+// redactingProcessor removes or hashes sensitive attributes on ended spans
+// before handing them to next, which is normally the exporter's processor.
+// Spans are redacted on the way out only, so in-process readers of the live
+// span still see the original values.
+type redactingProcessor struct {
+	next sdktrace.SpanProcessor
+	keys map[attribute.Key]struct{}
+	hash bool
+}
+
+func newRedactingProcessor(next sdktrace.SpanProcessor, keys []string, mode string) *redactingProcessor {
+	p := &redactingProcessor{
+		next: next,
+		keys: make(map[attribute.Key]struct{}, len(keys)),
+		hash: mode == "hash",
+	}
+	for _, k := range keys {
+		p.keys[attribute.Key(k)] = struct{}{}
+	}
+	return p
+}
+
+func (p *redactingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *redactingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs := s.Attributes()
+	sensitive := false
+	for _, attr := range attrs {
+		if _, ok := p.keys[attr.Key]; ok {
+			sensitive = true
+			break
+		}
+	}
+	if !sensitive {
+		p.next.OnEnd(s)
+		return
+	}
+
+	redacted := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		if _, ok := p.keys[attr.Key]; !ok {
+			redacted = append(redacted, attr)
+			continue
+		}
+		if p.hash {
+			sum := sha256.Sum256([]byte(attr.Value.Emit()))
+			redacted = append(redacted, attr.Key.String(hex.EncodeToString(sum[:])))
+		}
+	}
+	p.next.OnEnd(attributeOverrideSpan{ReadOnlySpan: s, attrs: redacted})
+}
+
+func (p *redactingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *redactingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// truncatingProcessor cuts string attribute values longer than limit
+// characters on ended spans before handing them to next, so every exported
+// span is bounded however its attributes were set. A cut value ends in an
+// ellipsis, counted in the limit. A limit of zero leaves spans unchanged.
+type truncatingProcessor struct {
+	next  sdktrace.SpanProcessor
+	limit int
+}
+
+func newTruncatingProcessor(next sdktrace.SpanProcessor, limit int) *truncatingProcessor {
+	return &truncatingProcessor{next: next, limit: limit}
+}
+
+func (p *truncatingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *truncatingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if p.limit <= 0 {
+		p.next.OnEnd(s)
+		return
+	}
+	attrs := s.Attributes()
+	var truncated []attribute.KeyValue
+	for i, attr := range attrs {
+		if attr.Value.Type() != attribute.STRING {
+			continue
+		}
+		v := attr.Value.AsString()
+		if utf8.RuneCountInString(v) <= p.limit {
+			continue
+		}
+		if truncated == nil {
+			truncated = slices.Clone(attrs)
+		}
+		truncated[i] = attr.Key.String(string([]rune(v)[:p.limit-1]) + "…")
+	}
+	if truncated == nil {
+		p.next.OnEnd(s)
+		return
+	}
+	p.next.OnEnd(attributeOverrideSpan{ReadOnlySpan: s, attrs: truncated})
+}
+
+func (p *truncatingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *truncatingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// attributeOverrideSpan is an ended span whose attributes have been replaced.
+type attributeOverrideSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s attributeOverrideSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+// truncatedKey and droppedSpansKey flag the local root of a trace that hit
+// the per-trace span cap.
+const (
+	truncatedKey    = attribute.Key("trace.truncated")
+	droppedSpansKey = attribute.Key("trace.dropped_spans")
+)
+
+// maxCappedTraces bounds how many traces spanCapProcessor tracks at once.
+// A trace is normally forgotten when its local root ends, but a root that
+// is never recorded, or whose end is withheld by another processor, would
+// otherwise be tracked forever.
+const maxCappedTraces = 10000
+
+// spanCapProcessor forwards at most max spans per trace to next. Further
+// spans of the trace are dropped, and the local root span is marked with
+// truncatedKey when it ends so runaway fan-out is visible in the backend.
+// Once maxCappedTraces traces are tracked the oldest is forgotten, and its
+// spans are forwarded from then on.
+type spanCapProcessor struct {
+	next sdktrace.SpanProcessor
+	max  int
+
+	mu     sync.Mutex
+	order  *list.List
+	traces map[trace.TraceID]*list.Element
+}
+
+// cappedTrace counts the spans started in a trace and remembers which of
+// them were dropped.
+type cappedTrace struct {
+	id      trace.TraceID
+	started int
+	dropped map[trace.SpanID]struct{}
+}
+
+func newSpanCapProcessor(next sdktrace.SpanProcessor, max int) *spanCapProcessor {
+	return &spanCapProcessor{
+		next:   next,
+		max:    max,
+		order:  list.New(),
+		traces: make(map[trace.TraceID]*list.Element),
+	}
+}
+
+func (p *spanCapProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	sc := s.SpanContext()
+
+	p.mu.Lock()
+	elem, ok := p.traces[sc.TraceID()]
+	if !ok {
+		elem = p.order.PushBack(&cappedTrace{id: sc.TraceID(), dropped: make(map[trace.SpanID]struct{})})
+		p.traces[sc.TraceID()] = elem
+		if p.order.Len() > maxCappedTraces {
+			oldest := p.order.Remove(p.order.Front()).(*cappedTrace)
+			delete(p.traces, oldest.id)
+		}
+	}
+	t := elem.Value.(*cappedTrace)
+	t.started++
+	drop := t.started > p.max
+	if drop {
+		t.dropped[sc.SpanID()] = struct{}{}
+	}
+	p.mu.Unlock()
+
+	if !drop {
+		p.next.OnStart(parent, s)
+	}
+}
+
+func (p *spanCapProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	isRoot := isLocalRoot(s.Parent())
+
+	var drop bool
+	var dropped int
+	p.mu.Lock()
+	if elem, ok := p.traces[sc.TraceID()]; ok {
+		t := elem.Value.(*cappedTrace)
+		_, drop = t.dropped[sc.SpanID()]
+		delete(t.dropped, sc.SpanID())
+		dropped = t.started - p.max
+		if isRoot {
+			// The trace is complete from this process's point of view
+			p.order.Remove(elem)
+			delete(p.traces, sc.TraceID())
+		}
+	}
+	p.mu.Unlock()
+
+	if drop {
+		return
+	}
+	if isRoot && dropped > 0 {
+		attrs := append(s.Attributes(), truncatedKey.Bool(true), droppedSpansKey.Int(dropped))
+		s = attributeOverrideSpan{ReadOnlySpan: s, attrs: attrs}
+	}
+	p.next.OnEnd(s)
+}
+
+// tracked returns the number of traces p is tracking.
+func (p *spanCapProcessor) tracked() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.order.Len()
+}
+
+func (p *spanCapProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *spanCapProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// dropProcessor withholds ended spans matching drop from next, deciding
+// once each span has its final status, unlike a sampler, which must decide
+// before the outcome is known.
+type dropProcessor struct {
+	next sdktrace.SpanProcessor
+	drop func(sdktrace.ReadOnlySpan) bool
+}
+
+func newDropProcessor(next sdktrace.SpanProcessor, drop func(sdktrace.ReadOnlySpan) bool) *dropProcessor {
+	return &dropProcessor{next: next, drop: drop}
+}
+
+func (p *dropProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *dropProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !p.drop(s) {
+		p.next.OnEnd(s)
+	}
+}
+
+func (p *dropProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *dropProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// successfulHealthCheck reports whether s is a /health request span that
+// answered 200 without an error status.
+func successfulHealthCheck(s sdktrace.ReadOnlySpan) bool {
+	if s.Status().Code == codes.Error {
+		return false
+	}
+	attrs := attribute.NewSet(s.Attributes()...)
+	endpoint, _ := attrs.Value("endpoint")
+	status, _ := attrs.Value("http.status_code")
+	return endpoint.AsString() == "/health" && status.AsInt64() == http.StatusOK
+}
+
+// gcPauseProcessor adds a "gc.pause" event to each local root span for
+// every garbage collection that completed while the span was open, so
+// latency spikes caused by GC are visible on the request that suffered them.
+type gcPauseProcessor struct {
+	next sdktrace.SpanProcessor
+
+	mu    sync.Mutex
+	start map[trace.SpanID]int64
+}
+
+func newGCPauseProcessor(next sdktrace.SpanProcessor) *gcPauseProcessor {
+	return &gcPauseProcessor{
+		next:  next,
+		start: make(map[trace.SpanID]int64),
+	}
+}
+
+func (p *gcPauseProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if isLocalRoot(s.Parent()) {
+		var stats debug.GCStats
+		debug.ReadGCStats(&stats)
+
+		p.mu.Lock()
+		p.start[s.SpanContext().SpanID()] = stats.NumGC
+		p.mu.Unlock()
+	}
+	p.next.OnStart(parent, s)
+}
+
+func (p *gcPauseProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	startGC, ok := p.start[s.SpanContext().SpanID()]
+	delete(p.start, s.SpanContext().SpanID())
+	p.mu.Unlock()
+
+	if ok {
+		var stats debug.GCStats
+		debug.ReadGCStats(&stats)
+
+		// Pause and PauseEnd are ordered most recent first
+		n := min(int(stats.NumGC-startGC), len(stats.Pause), len(stats.PauseEnd))
+		if n > 0 {
+			events := s.Events()
+			for i := n - 1; i >= 0; i-- {
+				events = append(events, sdktrace.Event{
+					Name:       "gc.pause",
+					Time:       stats.PauseEnd[i],
+					Attributes: []attribute.KeyValue{attribute.Int64("gc.pause_ns", stats.Pause[i].Nanoseconds())},
+				})
+			}
+			s = eventsOverrideSpan{ReadOnlySpan: s, events: events}
+		}
+	}
+	p.next.OnEnd(s)
+}
+
+func (p *gcPauseProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *gcPauseProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// eventsOverrideSpan is an ended span whose events have been replaced.
+type eventsOverrideSpan struct {
+	sdktrace.ReadOnlySpan
+	events []sdktrace.Event
+}
+
+func (s eventsOverrideSpan) Events() []sdktrace.Event {
+	return s.events
+}
+
+// isLocalRoot reports whether a span with the given parent is the first span
+// of its trace in this process.
+func isLocalRoot(parent trace.SpanContext) bool {
+	return !parent.IsValid() || parent.IsRemote()
+}
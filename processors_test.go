@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRedactingProcessor(t *testing.T) {
+	sum := sha256.Sum256([]byte("jane@example.com"))
+	hashed := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		mode      string
+		wantEmail string
+		wantFound bool
+	}{
+		{
+			name:      "remove",
+			mode:      "remove",
+			wantFound: false,
+		},
+		{
+			name:      "hash",
+			mode:      "hash",
+			wantEmail: hashed,
+			wantFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			processor := newRedactingProcessor(sdktrace.NewSimpleSpanProcessor(exporter), []string{"user.email"}, tt.mode)
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+			defer provider.Shutdown(context.Background())
+
+			_, span := provider.Tracer("test").Start(context.Background(), "redact")
+			span.SetAttributes(
+				attribute.String("user.email", "jane@example.com"),
+				attribute.String("user.id", "user-1"),
+			)
+			span.End()
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("Expected 1 exported span, got %d", len(spans))
+			}
+
+			attrs := attribute.NewSet(spans[0].Attributes...)
+			email, found := attrs.Value("user.email")
+			if found != tt.wantFound {
+				t.Fatalf("Expected user.email present=%v, got %v", tt.wantFound, found)
+			}
+			if found && email.AsString() != tt.wantEmail {
+				t.Errorf("Expected user.email %q, got %q", tt.wantEmail, email.AsString())
+			}
+			if id, _ := attrs.Value("user.id"); id.AsString() != "user-1" {
+				t.Errorf("Expected user.id to survive redaction, got %q", id.AsString())
+			}
+		})
+	}
+}
+
+func TestGlobalAttributes(t *testing.T) {
+	t.Setenv("GLOBAL_ATTRIBUTES", "cluster.name=prod-east, team=observability")
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(newAttributesProcessor(cfg.GlobalAttributes...)),
+		sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+	)
+	defer tracerProvider.Shutdown(ctx)
+
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(reader),
+	)
+	defer meterProvider.Shutdown(ctx)
+
+	_, span := tracerProvider.Tracer("test").Start(ctx, "global")
+	span.End()
+
+	counter, err := meterProvider.Meter("test").Int64Counter("global_test_total")
+	if err != nil {
+		t.Fatalf("Failed to create counter: %v", err)
+	}
+	counter.Add(ctx, 1)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	if _, ok := findMetric(rm, "global_test_total"); !ok {
+		t.Fatal("Expected global_test_total data point to be collected")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 exported span, got %d", len(spans))
+	}
+	spanAttrs := attribute.NewSet(spans[0].Attributes...)
+
+	tests := []struct {
+		name  string
+		key   attribute.Key
+		value string
+	}{
+		{name: "cluster name", key: "cluster.name", value: "prod-east"},
+		{name: "team", key: "team", value: "observability"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := spanAttrs.Value(tt.key); got.AsString() != tt.value {
+				t.Errorf("Expected span %s=%q, got %q", tt.key, tt.value, got.AsString())
+			}
+			if got, _ := rm.Resource.Set().Value(tt.key); got.AsString() != tt.value {
+				t.Errorf("Expected metric resource %s=%q, got %q", tt.key, tt.value, got.AsString())
+			}
+		})
+	}
+}
+
+func TestSpanCapProcessor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := newSpanCapProcessor(sdktrace.NewSimpleSpanProcessor(exporter), 3)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	for i := 0; i < 5; i++ {
+		_, child := tracer.Start(ctx, "child")
+		child.End()
+	}
+	root.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 exported spans under the cap, got %d", len(spans))
+	}
+
+	var rootStub *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].Name == "root" {
+			rootStub = &spans[i]
+		}
+	}
+	if rootStub == nil {
+		t.Fatal("Expected the root span to be exported")
+	}
+
+	attrs := attribute.NewSet(rootStub.Attributes...)
+	if truncated, _ := attrs.Value(truncatedKey); !truncated.AsBool() {
+		t.Errorf("Expected root span to carry %s=true", truncatedKey)
+	}
+	if dropped, _ := attrs.Value(droppedSpansKey); dropped.AsInt64() != 3 {
+		t.Errorf("Expected %s=3, got %d", droppedSpansKey, dropped.AsInt64())
+	}
+
+	// A fresh trace under the cap is untouched
+	exporter.Reset()
+	_, span := tracer.Start(context.Background(), "small")
+	span.End()
+	small := attribute.NewSet(exporter.GetSpans()[0].Attributes...)
+	if _, ok := small.Value(truncatedKey); ok {
+		t.Error("Expected no truncation attribute on a trace under the cap")
+	}
+}
+
+func TestSpanCapProcessorBoundsTrackedTraces(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := newSpanCapProcessor(sdktrace.NewSimpleSpanProcessor(exporter), 3)
+	// Roots are sampled out, so the processor never sees them end, but
+	// their children are still recorded
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample(),
+			sdktrace.WithLocalParentNotSampled(sdktrace.AlwaysSample()))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	for i := 0; i < maxCappedTraces+10; i++ {
+		ctx, root := tracer.Start(context.Background(), "root")
+		_, child := tracer.Start(ctx, "child")
+		child.End()
+		root.End()
+	}
+
+	if got := processor.tracked(); got != maxCappedTraces {
+		t.Errorf("Expected at most %d tracked traces, got %d", maxCappedTraces, got)
+	}
+	if got := len(exporter.GetSpans()); got != maxCappedTraces+10 {
+		t.Errorf("Expected every child exported, got %d", got)
+	}
+}
+
+func TestGCPauseProcessor(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(newGCPauseProcessor(sdktrace.NewSimpleSpanProcessor(exporter))),
+	)
+	defer provider.Shutdown(context.Background())
+	app.tracer = provider.Tracer("test-app")
+
+	gcHandler := func(w http.ResponseWriter, r *http.Request) {
+		_, span := app.startServerSpan(r, "gc_request")
+		defer span.End()
+		runtime.GC()
+	}
+	gcHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/gc", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 exported span, got %d", len(spans))
+	}
+	found := false
+	for _, event := range spans[0].Events {
+		if event.Name == "gc.pause" {
+			found = true
+			attrs := attribute.NewSet(event.Attributes...)
+			if pause, _ := attrs.Value("gc.pause_ns"); pause.AsInt64() <= 0 {
+				t.Errorf("Expected a positive gc.pause_ns, got %d", pause.AsInt64())
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected a gc.pause event, got %+v", spans[0].Events)
+	}
+}
+
+// stubSpanExporter records the spans it is asked to export.
+type stubSpanExporter struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (e *stubSpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *stubSpanExporter) Shutdown(context.Context) error { return nil }
+
+func (e *stubSpanExporter) exported() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.spans)
+}
+
+func TestNewSpanProcessorMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		wantExported int
+	}{
+		{
+			name:         "simple exports synchronously",
+			mode:         "simple",
+			wantExported: 1,
+		},
+		{
+			name:         "batch defers export",
+			mode:         "batch",
+			wantExported: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.SpanProcessor = tt.mode
+
+			exporter := &stubSpanExporter{}
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newSpanProcessor(cfg, exporter)))
+			defer provider.Shutdown(context.Background())
+
+			_, span := provider.Tracer("test").Start(context.Background(), "sync")
+			span.End()
+
+			if got := exporter.exported(); got != tt.wantExported {
+				t.Errorf("Expected %d spans exported when End returns, got %d", tt.wantExported, got)
+			}
+		})
+	}
+}
+
+func TestDropHealthySpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &Config{SpanProcessor: "simple", DropHealthySpans: true}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newSpanProcessor(cfg, exporter)))
+	defer provider.Shutdown(context.Background())
+	app, err := newApp(provider, sdkmetric.NewMeterProvider())
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		endpoint   string
+		status     int
+		wantExport bool
+	}{
+		{name: "successful health check", endpoint: "/health", status: http.StatusOK},
+		{name: "failed health check", endpoint: "/health", status: http.StatusServiceUnavailable, wantExport: true},
+		{name: "successful work", endpoint: "/work", status: http.StatusOK, wantExport: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			h := app.withTelemetry(tt.endpoint, "request", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.endpoint, nil))
+
+			if exported := len(exporter.GetSpans()) == 1; exported != tt.wantExport {
+				t.Errorf("Expected span exported=%v, got %d spans", tt.wantExport, len(exporter.GetSpans()))
+			}
+		})
+	}
+}
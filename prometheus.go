@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// prometheusHandler serves the scrape endpoint when Config.PrometheusEnabled
+// is set; initTelemetry replaces it.
+var prometheusHandler http.Handler = http.NotFoundHandler()
+
+// newPrometheusReader returns a reader exposing the meter provider's
+// instruments in the Prometheus format, next to the OTLP push, and the
+// handler serving them. Each reader gets its own registry so providers do
+// not collide in the process-wide default one.
+func newPrometheusReader() (sdkmetric.Reader, http.Handler, error) {
+	registry := promclient.NewRegistry()
+	exporter, err := prometheus.New(prometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+	}
+	return exporter, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestPrometheusScrape(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	reader, handler, err := newPrometheusReader()
+	if err != nil {
+		t.Fatalf("Failed to create prometheus reader: %v", err)
+	}
+	pushReader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithReader(pushReader))
+	defer provider.Shutdown(context.Background())
+	app.meter = provider.Meter("sample-app")
+	if err := app.initInstruments(); err != nil {
+		t.Fatalf("Failed to create instruments: %v", err)
+	}
+
+	ctx := context.Background()
+	app.countRequest(ctx, attribute.String("endpoint", "/work"), attribute.String("status", "200"))
+	app.recordDuration(ctx, (250 * time.Millisecond).Seconds(), attribute.String("endpoint", "/work"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prometheus", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`http_requests_total{endpoint="/work"`,
+		`http_request_duration_seconds_count{endpoint="/work"`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected scrape to contain %s, got:\n%s", want, body)
+		}
+	}
+
+	// The same measurements are still available to the push readers
+	var rm metricdata.ResourceMetrics
+	if err := pushReader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	if got := counterValue(t, rm, "http_requests_total"); got != 1 {
+		t.Errorf("Expected http_requests_total 1 on the OTLP reader, got %d", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tenantIDKey is the baggage member upstream services pass the tenant in,
+// recorded under the same span attribute key.
+const tenantIDKey = "tenant.id"
+
+// otherTenant replaces tenants not in Config.MetricTenants on the request
+// metrics.
+const otherTenant = "other"
+
+// baggageAttributes returns the span attributes taken from the baggage in
+// ctx: the tenant ID, when an upstream service set one.
+func baggageAttributes(ctx context.Context) []attribute.KeyValue {
+	if tenant := baggage.FromContext(ctx).Member(tenantIDKey).Value(); tenant != "" {
+		return []attribute.KeyValue{attribute.String(tenantIDKey, tenant)}
+	}
+	return nil
+}
+
+// tenantMetricAttributes returns the tenant in ctx's baggage under
+// Config.TenantMetricKey, for labelling request metrics per tenant. Tenants
+// not in Config.MetricTenants are reported as otherTenant.
+func tenantMetricAttributes(ctx context.Context) []attribute.KeyValue {
+	if appConfig.TenantMetricKey == "" {
+		return nil
+	}
+	tenant := baggage.FromContext(ctx).Member(tenantIDKey).Value()
+	if tenant == "" {
+		return nil
+	}
+	if !slices.Contains(appConfig.MetricTenants, tenant) {
+		tenant = otherTenant
+	}
+	return []attribute.KeyValue{attribute.String(appConfig.TenantMetricKey, tenant)}
+}
+
+// propagationCheck is the /debug/propagation response.
+type propagationCheck struct {
+	Fields           []string          `json:"fields"`
+	Carrier          map[string]string `json:"carrier"`
+	TraceID          string            `json:"trace_id"`
+	SpanID           string            `json:"span_id"`
+	TraceIDPreserved bool              `json:"trace_id_preserved"`
+	SpanIDPreserved  bool              `json:"span_id_preserved"`
+	BaggagePreserved bool              `json:"baggage_preserved"`
+	OK               bool              `json:"ok"`
+}
+
+// propagationHandler self-tests the configured propagator: it injects the
+// current context (the request's, or the one propagated in its headers)
+// into a carrier, extracts it back and reports whether the trace ID, span
+// ID and baggage survived the round trip.
+func propagationHandler(w http.ResponseWriter, r *http.Request) {
+	propagator := otel.GetTextMapPropagator()
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	extracted := propagator.Extract(context.Background(), carrier)
+
+	want := trace.SpanContextFromContext(ctx)
+	got := trace.SpanContextFromContext(extracted)
+	fields := propagator.Fields()
+	sort.Strings(fields)
+	check := propagationCheck{
+		Fields:           fields,
+		Carrier:          carrier,
+		TraceID:          want.TraceID().String(),
+		SpanID:           want.SpanID().String(),
+		TraceIDPreserved: want.HasTraceID() && got.TraceID() == want.TraceID(),
+		SpanIDPreserved:  want.HasSpanID() && got.SpanID() == want.SpanID(),
+		BaggagePreserved: baggage.FromContext(extracted).String() == baggage.FromContext(ctx).String(),
+	}
+	check.OK = check.TraceIDPreserved && check.SpanIDPreserved && check.BaggagePreserved
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestPropagationHandler(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		propagator propagation.TextMapPropagator
+		wantOK     bool
+	}{
+		{
+			name:       "trace context and baggage",
+			propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+			wantOK:     true,
+		},
+		{
+			name:       "baggage is lost without its propagator",
+			propagator: propagation.TraceContext{},
+			wantOK:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := otel.GetTextMapPropagator()
+			otel.SetTextMapPropagator(tt.propagator)
+			t.Cleanup(func() { otel.SetTextMapPropagator(orig) })
+
+			member, err := baggage.NewMember("tenant", "acme")
+			if err != nil {
+				t.Fatalf("Failed to create baggage member: %v", err)
+			}
+			bag, err := baggage.New(member)
+			if err != nil {
+				t.Fatalf("Failed to create baggage: %v", err)
+			}
+			ctx, span := app.tracer.Start(baggage.ContextWithBaggage(context.Background(), bag), "caller")
+			defer span.End()
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/propagation", nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+			propagationHandler(w, req)
+
+			var check propagationCheck
+			if err := json.NewDecoder(w.Body).Decode(&check); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !check.TraceIDPreserved || !check.SpanIDPreserved {
+				t.Errorf("Expected trace and span IDs to round-trip, got %+v", check)
+			}
+			if check.TraceID != span.SpanContext().TraceID().String() {
+				t.Errorf("Expected trace_id %s, got %s", span.SpanContext().TraceID(), check.TraceID)
+			}
+			if check.OK != tt.wantOK {
+				t.Errorf("Expected ok=%v, got %+v", tt.wantOK, check)
+			}
+		})
+	}
+}
+
+func TestBaggageTenantAcrossNestedSpan(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.MaxWorkLatency = 10 * time.Millisecond })
+
+	req := httptest.NewRequest(http.MethodGet, "/work", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("baggage", "tenant.id=acme,region=eu")
+	app.serveWork(httptest.NewRecorder(), req)
+
+	for _, name := range []string{"do_work", "nested_operation"} {
+		if tenant, _ := spanAttribute(endedSpan(t, name), "tenant.id"); tenant.AsString() != "acme" {
+			t.Errorf("Expected tenant.id=acme on %s, got %q", name, tenant.AsString())
+		}
+	}
+	if region, ok := spanAttribute(endedSpan(t, "do_work"), "region"); ok {
+		t.Errorf("Expected only tenant.id to be copied from baggage, got region=%q", region.AsString())
+	}
+}
+
+func TestTenantMetricSeries(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.TenantMetricKey = "service.namespace"
+		c.MetricTenants = []string{"acme", "globex"}
+	})
+
+	for _, tenant := range []string{"acme", "globex", "globex", "initech", "hooli"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("baggage", "tenant.id="+tenant)
+		app.serveHealth(httptest.NewRecorder(), req)
+	}
+	app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	rm := collectMetrics(t)
+	for tenant, want := range map[string]int64{"acme": 1, "globex": 2, "other": 2} {
+		if n := counterValue(t, rm, "http_requests_total", attribute.String("service.namespace", tenant)); n != want {
+			t.Errorf("Expected %d requests for tenant %s, got %d", want, tenant, n)
+		}
+	}
+	m, ok := findMetric(rm, "http_request_duration_seconds")
+	if !ok {
+		t.Fatal("Expected http_request_duration_seconds to be collected")
+	}
+	if points := m.Data.(metricdata.Histogram[float64]).DataPoints; len(points) != 4 {
+		t.Errorf("Expected a duration series per allowed tenant, one for other and one without, got %d", len(points))
+	}
+}
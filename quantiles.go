@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// reportedQuantiles are the quantiles published per endpoint.
+var reportedQuantiles = []float64{0.5, 0.95, 0.99}
+
+// quantileEstimator keeps the most recent request durations per endpoint in
+// a fixed-size window and estimates quantiles from them client-side, for
+// backends that cannot compute quantiles from histograms.
+type quantileEstimator struct {
+	mu      sync.Mutex
+	size    int
+	windows map[string]*durationWindow
+}
+
+// durationWindow is a ring buffer of the latest durations.
+type durationWindow struct {
+	values []float64
+	next   int
+}
+
+func newQuantileEstimator(size int) *quantileEstimator {
+	return &quantileEstimator{
+		size:    size,
+		windows: make(map[string]*durationWindow),
+	}
+}
+
+// observe adds a duration for endpoint, evicting the oldest once the window
+// is full.
+func (q *quantileEstimator) observe(endpoint string, seconds float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	w, ok := q.windows[endpoint]
+	if !ok {
+		w = &durationWindow{values: make([]float64, 0, q.size)}
+		q.windows[endpoint] = w
+	}
+	if len(w.values) < q.size {
+		w.values = append(w.values, seconds)
+		return
+	}
+	w.values[w.next] = seconds
+	w.next = (w.next + 1) % q.size
+}
+
+// snapshot returns the reportedQuantiles for every endpoint with data,
+// using the nearest-rank method.
+func (q *quantileEstimator) snapshot() map[string][]float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make(map[string][]float64, len(q.windows))
+	for endpoint, w := range q.windows {
+		sorted := append([]float64(nil), w.values...)
+		sort.Float64s(sorted)
+
+		values := make([]float64, len(reportedQuantiles))
+		for i, p := range reportedQuantiles {
+			rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+			values[i] = sorted[max(rank, 0)]
+		}
+		result[endpoint] = values
+	}
+	return result
+}
+
+// registerQuantileGauges publishes q through the
+// http_request_duration_quantile_seconds gauge.
+func registerQuantileGauges(m metric.Meter, q *quantileEstimator) error {
+	_, err := m.Float64ObservableGauge(
+		"http_request_duration_quantile_seconds",
+		metric.WithDescription("Client-side estimate of HTTP request duration quantiles over a rolling window"),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			for endpoint, values := range q.snapshot() {
+				for i, p := range reportedQuantiles {
+					o.Observe(values[i], metric.WithAttributes(
+						attribute.String("endpoint", endpoint),
+						attribute.String("quantile", strconv.FormatFloat(p, 'f', -1, 64)),
+					))
+				}
+			}
+			return nil
+		}),
+	)
+	return err
+}
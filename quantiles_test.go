@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestQuantileGauges(t *testing.T) {
+	withConfig(t, func(c *Config) { c.DurationQuantileWindow = 1000 })
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	// Uniform durations of 1ms..1000ms: p50=0.5s, p95=0.95s, p99=0.99s
+	ctx := context.Background()
+	for i := 1; i <= 1000; i++ {
+		app.recordDuration(ctx, float64(i)/1000, attribute.String("endpoint", "/work"))
+	}
+
+	m, ok := findMetric(collectMetrics(t), "http_request_duration_quantile_seconds")
+	if !ok {
+		t.Fatal("Expected http_request_duration_quantile_seconds to be collected")
+	}
+	gauge := m.Data.(metricdata.Gauge[float64])
+
+	tests := []struct {
+		name     string
+		quantile string
+		expected float64
+	}{
+		{name: "p50", quantile: "0.5", expected: 0.5},
+		{name: "p95", quantile: "0.95", expected: 0.95},
+		{name: "p99", quantile: "0.99", expected: 0.99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dp := range gauge.DataPoints {
+				if hasAttributes(dp.Attributes, attribute.String("endpoint", "/work"), attribute.String("quantile", tt.quantile)) {
+					if math.Abs(dp.Value-tt.expected) > 0.01 {
+						t.Errorf("Expected %s within 0.01 of %v, got %v", tt.name, tt.expected, dp.Value)
+					}
+					return
+				}
+			}
+			t.Errorf("No data point for quantile %s", tt.quantile)
+		})
+	}
+}
+
+func TestQuantileEstimatorWindow(t *testing.T) {
+	q := newQuantileEstimator(10)
+	for i := 0; i < 10; i++ {
+		q.observe("/work", 100)
+	}
+	for i := 0; i < 10; i++ {
+		q.observe("/work", 1)
+	}
+
+	if got := q.snapshot()["/work"][2]; got != 1 {
+		t.Errorf("Expected old values to be evicted from the window, p99 = %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	// telemetryReady is set once initTelemetry has completed.
+	telemetryReady atomic.Bool
+	// exportSucceeded is set by the first span or metric export the
+	// collector accepts.
+	exportSucceeded atomic.Bool
+)
+
+// readySpanExporter marks exportSucceeded after a successful span export.
+type readySpanExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e readySpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err == nil {
+		exportSucceeded.Store(true)
+	}
+	return err
+}
+
+// readyMetricExporter marks exportSucceeded after a successful metric
+// export.
+type readyMetricExporter struct {
+	sdkmetric.Exporter
+}
+
+func (e readyMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	if err == nil {
+		exportSucceeded.Store(true)
+	}
+	return err
+}
+
+// awaitFirstExport calls flush, which exports the metrics collected so far,
+// every interval until the collector accepts an export, so /ready does not
+// wait for the periodic reader's first export a minute after startup. It
+// stops early once the reader is shut down.
+func awaitFirstExport(flush func(context.Context) error, interval, timeout time.Duration) {
+	for !exportSucceeded.Load() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := flush(ctx)
+		cancel()
+		if errors.Is(err, sdkmetric.ErrReaderShutdown) || exportSucceeded.Load() {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// readyHandler is the readiness probe: unlike /health it returns 503 until
+// telemetry is initialized and the collector has accepted an export, so no
+// traffic is routed before telemetry is wired up. Probes are not traced.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case !telemetryReady.Load():
+		http.Error(w, "telemetry not initialized", http.StatusServiceUnavailable)
+	case !exportSucceeded.Load():
+		http.Error(w, "waiting for the first successful export", http.StatusServiceUnavailable)
+	default:
+		w.Write([]byte("OK"))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestReadyHandler(t *testing.T) {
+	t.Cleanup(func() {
+		telemetryReady.Store(false)
+		exportSucceeded.Store(false)
+	})
+	telemetryReady.Store(false)
+	exportSucceeded.Store(false)
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		readyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+
+	if got := ready(); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d before init, got %d", http.StatusServiceUnavailable, got)
+	}
+
+	telemetryReady.Store(true)
+	if got := ready(); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d before the first export, got %d", http.StatusServiceUnavailable, got)
+	}
+
+	if err := (readySpanExporter{&stubSpanExporter{}}).ExportSpans(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to export spans: %v", err)
+	}
+	if got := ready(); got != http.StatusOK {
+		t.Errorf("Expected status %d after a successful export, got %d", http.StatusOK, got)
+	}
+}
+
+func TestAwaitFirstExport(t *testing.T) {
+	t.Cleanup(func() { exportSucceeded.Store(false) })
+
+	tests := []struct {
+		name      string
+		flush     func(calls int) error
+		wantCalls int
+		wantReady bool
+	}{
+		{
+			name: "collector starts late",
+			flush: func(calls int) error {
+				if calls < 3 {
+					return errors.New("connection refused")
+				}
+				exportSucceeded.Store(true)
+				return nil
+			},
+			wantCalls: 3,
+			wantReady: true,
+		},
+		{
+			name:      "reader shut down",
+			flush:     func(int) error { return sdkmetric.ErrReaderShutdown },
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exportSucceeded.Store(false)
+			calls := 0
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				awaitFirstExport(func(context.Context) error {
+					calls++
+					return tt.flush(calls)
+				}, time.Millisecond, time.Second)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected awaitFirstExport to return")
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d flushes, got %d", tt.wantCalls, calls)
+			}
+			if got := exportSucceeded.Load(); got != tt.wantReady {
+				t.Errorf("Expected exportSucceeded %v, got %v", tt.wantReady, got)
+			}
+		})
+	}
+}
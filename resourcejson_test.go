@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestMarshalResourceJSON(t *testing.T) {
+	cfg := LoadConfigFromEnv()
+	cfg.ReleaseID = "2025.01.1"
+	cfg.GlobalAttributes = []attribute.KeyValue{
+		attribute.Int("shard", 7),
+		attribute.Bool("canary", true),
+	}
+	res, err := newResource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+
+	data, err := marshalResourceJSON(res)
+	if err != nil {
+		t.Fatalf("Failed to serialize resource: %v", err)
+	}
+
+	var got struct {
+		Attributes []struct {
+			Key   string         `json:"key"`
+			Value map[string]any `json:"value"`
+		} `json:"attributes"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to decode %s: %v", data, err)
+	}
+	values := make(map[string]map[string]any)
+	for _, kv := range got.Attributes {
+		values[kv.Key] = kv.Value
+	}
+
+	tests := []struct {
+		key      string
+		field    string
+		expected any
+	}{
+		{key: "service.name", field: "stringValue", expected: "sample-app"},
+		{key: "release.id", field: "stringValue", expected: "2025.01.1"},
+		{key: "shard", field: "intValue", expected: "7"},
+		{key: "canary", field: "boolValue", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, ok := values[tt.key]
+			if !ok {
+				t.Fatalf("Expected attribute %q in %s", tt.key, data)
+			}
+			if len(value) != 1 || value[tt.field] != tt.expected {
+				t.Errorf("Expected value {%q: %v}, got %v", tt.field, tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestResourceHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	resourceHandler(w, httptest.NewRequest(http.MethodGet, "/debug/resource", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type %q, got %q", "application/json", contentType)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// retryAttemptKey numbers the attempts of a retried operation from 1.
+const retryAttemptKey = attribute.Key("retry.attempt")
+
+// retry runs fn until it succeeds or has been retried retries times,
+// doubling the wait from backoff between attempts, and returns the last
+// error. Attempts are traced as Config.RetryTelemetryMode says.
+func (a *App) retry(ctx context.Context, retries int, backoff time.Duration, fn func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := a.runAttempt(ctx, attempt, fn)
+		if err == nil || attempt > retries {
+			return err
+		}
+		if sleepContext(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// runAttempt runs attempt number attempt of fn. In "spans" mode it runs in
+// a child span named "attempt N" that records its error; otherwise a failure
+// is recorded as an attempt_failed event on the span in ctx.
+func (a *App) runAttempt(ctx context.Context, attempt int, fn func(context.Context) error) error {
+	if appConfig.RetryTelemetryMode != "spans" {
+		err := fn(ctx)
+		if err != nil {
+			trace.SpanFromContext(ctx).AddEvent("attempt_failed", trace.WithAttributes(
+				retryAttemptKey.Int(attempt),
+				attribute.String("error", err.Error()),
+			))
+		}
+		return err
+	}
+
+	ctx, span := a.tracer.Start(ctx, fmt.Sprintf("attempt %d", attempt), trace.WithAttributes(retryAttemptKey.Int(attempt)))
+	defer span.End()
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
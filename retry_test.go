@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRetryTelemetryMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		wantAttempts int
+		wantEvents   int
+	}{
+		{name: "spans", mode: "spans", wantAttempts: 3},
+		{name: "events", mode: "events", wantEvents: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) { c.RetryTelemetryMode = tt.mode })
+
+			calls := 0
+			ctx, parent := app.tracer.Start(context.Background(), "parent")
+			err = app.retry(ctx, 2, 0, func(context.Context) error {
+				calls++
+				if calls <= 2 {
+					return errors.New("downstream unavailable")
+				}
+				return nil
+			})
+			parent.End()
+			if err != nil {
+				t.Fatalf("Expected the third attempt to succeed, got %v", err)
+			}
+
+			attempts := 0
+			for _, span := range spanRecorder.Ended() {
+				if span.Name() != fmt.Sprintf("attempt %d", attempts+1) {
+					continue
+				}
+				attempts++
+				if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+					t.Errorf("Expected %q under the parent span", span.Name())
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempt spans, got %d", tt.wantAttempts, attempts)
+			}
+
+			events := 0
+			for _, event := range endedSpan(t, "parent").Events() {
+				if event.Name == "attempt_failed" {
+					events++
+				}
+			}
+			if events != tt.wantEvents {
+				t.Errorf("Expected %d attempt_failed events, got %d", tt.wantEvents, events)
+			}
+		})
+	}
+}
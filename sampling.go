@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultTraceSampler is the head sampler used when OTEL_TRACES_SAMPLER is
+// unset, as in the SDK.
+const defaultTraceSampler = "parentbased_always_on"
+
+// newSampler builds the head sampler named by cfg.TraceSampler, using the
+// OTEL_TRACES_SAMPLER vocabulary. The ratio samplers read their probability
+// from cfg.TraceSamplerArg and default to 1.0 when it is empty. A
+// cfg.SampleRatio below 1.0, which Validate only accepts alongside the
+// default sampler, selects a parent-based ratio sampler instead. Per-route
+// ratios in cfg.TraceRouteSampleRatios take precedence for request spans,
+// and spans marked for forced sampling are always recorded. With
+// cfg.RecordSamplingSource, the head sampler's decisions are annotated with
+// their source.
+func newSampler(cfg *Config) (sdktrace.Sampler, error) {
+	sampler, err := newBaseSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RecordSamplingSource {
+		sampler = decisionSourceSampler{
+			next:        sampler,
+			parentBased: cfg.SampleRatio < 1 || strings.HasPrefix(cfg.TraceSampler, "parentbased_"),
+		}
+	}
+	if len(cfg.TraceRouteSampleRatios) > 0 {
+		sampler = newRouteSampler(cfg.TraceRouteSampleRatios, sampler)
+	}
+	if cfg.ForceSampleRequestBytes > 0 {
+		sampler = forceSampler{next: sampler}
+	}
+	return sampler, nil
+}
+
+func newBaseSampler(cfg *Config) (sdktrace.Sampler, error) {
+	if cfg.SampleRatio < 1 {
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio)), nil
+	}
+	switch cfg.TraceSampler {
+	case "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case "traceidratio", "parentbased_traceidratio":
+		ratio, err := samplerRatio(cfg.TraceSamplerArg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.TraceSampler == "traceidratio" {
+			return sdktrace.TraceIDRatioBased(ratio), nil
+		}
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unsupported trace sampler %q", cfg.TraceSampler)
+	}
+}
+
+func samplerRatio(arg string) (float64, error) {
+	if arg == "" {
+		return 1.0, nil
+	}
+	ratio, err := strconv.ParseFloat(arg, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("invalid trace sampler argument %q: must be a ratio between 0 and 1", arg)
+	}
+	return ratio, nil
+}
+
+// decisionSourceKey records whether a span's sampling decision was
+// inherited from its parent ("parent") or made by the local sampler
+// ("local").
+const decisionSourceKey = attribute.Key("sampling.decision_source")
+
+// decisionSourceSampler annotates next's decisions with decisionSourceKey.
+// A ParentBased sampler follows the parent whenever the parent span context
+// is valid, so that is when the decision is the parent's.
+type decisionSourceSampler struct {
+	next        sdktrace.Sampler
+	parentBased bool
+}
+
+func (s decisionSourceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.next.ShouldSample(p)
+	source := "local"
+	if s.parentBased && trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		source = "parent"
+	}
+	result.Attributes = append(result.Attributes, decisionSourceKey.String(source))
+	return result
+}
+
+func (s decisionSourceSampler) Description() string {
+	return s.next.Description()
+}
+
+// routeKey is the span attribute holding the matched route template.
+const routeKey = attribute.Key("http.route")
+
+// routeSampler applies a per-route sampling ratio to spans that carry an
+// http.route attribute at start, deferring to fallback for everything else.
+type routeSampler struct {
+	routes   map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+func newRouteSampler(ratios map[string]float64, fallback sdktrace.Sampler) *routeSampler {
+	routes := make(map[string]sdktrace.Sampler, len(ratios))
+	for route, ratio := range ratios {
+		routes[route] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	return &routeSampler{routes: routes, fallback: fallback}
+}
+
+func (s *routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key == routeKey {
+			if sampler, ok := s.routes[attr.Value.AsString()]; ok {
+				return sampler.ShouldSample(p)
+			}
+			break
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *routeSampler) Description() string {
+	routes := make([]string, 0, len(s.routes))
+	for route, sampler := range s.routes {
+		routes = append(routes, route+"="+sampler.Description())
+	}
+	sort.Strings(routes)
+	return fmt.Sprintf("RouteSampler{%s,fallback:%s}", strings.Join(routes, ","), s.fallback.Description())
+}
+
+// parseRouteRatios parses comma-separated route=ratio pairs.
+func parseRouteRatios(v string) (map[string]float64, error) {
+	ratios := make(map[string]float64)
+	for _, pair := range splitList(v) {
+		route, raw, ok := strings.Cut(pair, "=")
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid route sampling ratio %q: must be route=ratio", pair)
+		}
+		ratio, err := samplerRatio(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route sampling ratio %q: %w", pair, err)
+		}
+		ratios[strings.TrimSpace(route)] = ratio
+	}
+	return ratios, nil
+}
+
+// forceSampleKey marks a span at start as one that must be sampled, such as
+// a request larger than Config.ForceSampleRequestBytes.
+const forceSampleKey = attribute.Key("sampling.force")
+
+// forceSampler records and samples spans carrying forceSampleKey=true and
+// defers to next for everything else.
+type forceSampler struct {
+	next sdktrace.Sampler
+}
+
+func (s forceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key == forceSampleKey && attr.Value.AsBool() {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s forceSampler) Description() string {
+	return fmt.Sprintf("ForceSampler{%s}", s.next.Description())
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewSamplerFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		sampler       string
+		arg           string
+		wantRecording bool
+	}{
+		{
+			name:          "traceidratio zero",
+			sampler:       "traceidratio",
+			arg:           "0",
+			wantRecording: false,
+		},
+		{
+			name:          "parentbased traceidratio one",
+			sampler:       "parentbased_traceidratio",
+			arg:           "1",
+			wantRecording: true,
+		},
+		{
+			name:          "always off",
+			sampler:       "always_off",
+			wantRecording: false,
+		},
+		{
+			name:          "always on",
+			sampler:       "always_on",
+			wantRecording: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+			t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+
+			sampler, err := newSampler(LoadConfigFromEnv())
+			if err != nil {
+				t.Fatalf("Failed to build sampler: %v", err)
+			}
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(sampler),
+				sdktrace.WithSpanProcessor(recorder),
+			)
+			defer provider.Shutdown(context.Background())
+
+			_, span := provider.Tracer("test").Start(context.Background(), "root")
+			span.End()
+
+			if got := len(recorder.Ended()) == 1; got != tt.wantRecording {
+				t.Errorf("Expected root span recorded=%v, got %v", tt.wantRecording, got)
+			}
+		})
+	}
+}
+
+func TestNewSamplerInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler string
+		arg     string
+	}{
+		{name: "unknown sampler", sampler: "jaeger_remote"},
+		{name: "ratio out of range", sampler: "traceidratio", arg: "1.5"},
+		{name: "ratio not a number", sampler: "traceidratio", arg: "half"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.TraceSampler = tt.sampler
+			cfg.TraceSamplerArg = tt.arg
+			if _, err := newSampler(cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRouteSampler(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.MaxWorkLatency = time.Millisecond })
+	t.Setenv("TRACE_ROUTE_SAMPLE_RATIOS", "/work=1.0,/health=0.0")
+
+	sampler, err := newSampler(LoadConfigFromEnv())
+	if err != nil {
+		t.Fatalf("Failed to build sampler: %v", err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	defer provider.Shutdown(context.Background())
+	app.tracer = provider.Tracer("test-app")
+
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		app.serveWork(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+		app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	}
+
+	counts := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		counts[span.Name()]++
+	}
+	if counts["do_work"] != requests {
+		t.Errorf("Expected %d do_work spans, got %d", requests, counts["do_work"])
+	}
+	if counts["health_check"] != 0 {
+		t.Errorf("Expected 0 health_check spans, got %d", counts["health_check"])
+	}
+}
+
+func TestParseRouteRatiosInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "missing ratio", value: "/work"},
+		{name: "missing route", value: "=0.5"},
+		{name: "ratio out of range", value: "/work=2"},
+		{name: "ratio not a number", value: "/work=all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseRouteRatios(tt.value); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestForceSampleLargeRequests(t *testing.T) {
+	tests := []struct {
+		name          string
+		bodySize      int
+		wantRecording bool
+	}{
+		{name: "large body", bodySize: 4096, wantRecording: true},
+		{name: "small body", bodySize: 16, wantRecording: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) {
+				c.TraceSampler = "traceidratio"
+				c.TraceSamplerArg = "0"
+				c.ForceSampleRequestBytes = 1024
+			})
+
+			sampler, err := newSampler(appConfig)
+			if err != nil {
+				t.Fatalf("Failed to build sampler: %v", err)
+			}
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(sampler),
+				sdktrace.WithSpanProcessor(recorder),
+			)
+			defer provider.Shutdown(context.Background())
+			app.tracer = provider.Tracer("test-app")
+
+			body := strings.NewReader(strings.Repeat("x", tt.bodySize))
+			req := httptest.NewRequest(http.MethodPost, "/health", body)
+			app.serveHealth(httptest.NewRecorder(), req)
+
+			if got := len(recorder.Ended()) == 1; got != tt.wantRecording {
+				t.Errorf("Expected span recorded=%v, got %v", tt.wantRecording, got)
+			}
+		})
+	}
+}
+
+func TestSamplingDecisionSource(t *testing.T) {
+	remoteParent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	tests := []struct {
+		name       string
+		parent     trace.SpanContext
+		wantSource string
+	}{
+		{
+			name:       "sampled parent",
+			parent:     remoteParent,
+			wantSource: "parent",
+		},
+		{
+			name:       "fresh root",
+			wantSource: "local",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadConfigFromEnv()
+			cfg.TraceSampler = "parentbased_always_on"
+			cfg.RecordSamplingSource = true
+			sampler, err := newSampler(cfg)
+			if err != nil {
+				t.Fatalf("Failed to build sampler: %v", err)
+			}
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(sampler),
+				sdktrace.WithSpanProcessor(recorder),
+			)
+			defer provider.Shutdown(context.Background())
+
+			ctx := trace.ContextWithRemoteSpanContext(context.Background(), tt.parent)
+			_, span := provider.Tracer("test").Start(ctx, "request")
+			span.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("Expected 1 recorded span, got %d", len(spans))
+			}
+			if got, _ := spanAttribute(spans[0], string(decisionSourceKey)); got.AsString() != tt.wantSource {
+				t.Errorf("Expected %s=%q, got %q", decisionSourceKey, tt.wantSource, got.AsString())
+			}
+		})
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	t.Setenv("TRACE_SAMPLE_RATIO", "0.1")
+	sampler, err := newSampler(LoadConfigFromEnv())
+	if err != nil {
+		t.Fatalf("Failed to build sampler: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	const roots = 1000
+	for i := 0; i < roots; i++ {
+		_, span := tracer.Start(context.Background(), "work_request")
+		span.End()
+	}
+	if n := len(recorder.Ended()); n < roots/20 || n > roots/5 {
+		t.Errorf("Expected roughly 10%% of %d root spans recorded, got %d", roots, n)
+	}
+
+	tests := []struct {
+		name         string
+		flags        trace.TraceFlags
+		wantRecorded int
+	}{
+		{name: "sampled parent", flags: trace.FlagsSampled, wantRecorded: 10},
+		{name: "unsampled parent", wantRecorded: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			for i := 0; i < 10; i++ {
+				parent := trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID:    trace.TraceID{byte(i + 1)},
+					SpanID:     trace.SpanID{0x01},
+					TraceFlags: tt.flags,
+					Remote:     true,
+				})
+				_, span := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child")
+				span.End()
+			}
+			if got := len(recorder.Ended()) - before; got != tt.wantRecorded {
+				t.Errorf("Expected %d of 10 children recorded, following the parent, got %d", tt.wantRecorded, got)
+			}
+		})
+	}
+}
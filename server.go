@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// listen opens the server listener on cfg's address. The "tcp" network binds
+// an unspecified host on both IPv4 and IPv6 where the host supports it. When
+// the port is in use, binding is retried cfg.ListenRetries times, doubling
+// the wait from cfg.ListenRetryBackoff, before a conflict error naming the
+// port is returned. A TLS certificate that does not load fails before
+// binding.
+func listen(cfg *Config) (net.Listener, error) {
+	if err := cfg.checkCertificate(); err != nil {
+		return nil, err
+	}
+	addr := cfg.listenAddr()
+	backoff := cfg.ListenRetryBackoff
+	for attempt := 0; ; attempt++ {
+		ln, err := net.Listen(cfg.ListenNetwork, addr)
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("failed to listen on %s address %s: %w", cfg.ListenNetwork, addr, err)
+		}
+		if attempt >= cfg.ListenRetries {
+			_, port, _ := net.SplitHostPort(addr)
+			return nil, fmt.Errorf("port %s is already in use after %d attempts; stop the other process or choose a free address with ADDR, PORT, -addr or -port: %w",
+				port, attempt+1, err)
+		}
+		slog.Warn("Address in use, retrying", "addr", addr, "attempt", attempt+1, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// serve runs srv on ln, over TLS when cfg has a certificate, refusing
+// clients older than cfg.TLSMinVersion.
+func serve(cfg *Config, srv *http.Server, ln net.Listener) error {
+	if cfg.TLSCertFile != "" {
+		srv.TLSConfig = cfg.tlsConfig()
+		return srv.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+	return srv.Serve(ln)
+}
+
+// startServerSpan starts the span for an incoming request as a child of the
+// caller's propagated trace context, tagged with the attributes every
+// endpoint shares. They are passed at start so samplers can use them.
+// Requests without a valid incoming context are counted in
+// missingTraceCounter to show which callers are not instrumented. A tenant
+// ID in the propagated baggage is recorded on the span. The request's
+// experiment variant, if any, is recorded on the span and kept in
+// the returned context for countRequest. The feature flags enabled at
+// the start are listed in feature_flags. The span starts and ends at
+// spanClock's time.
+func (a *App) startServerSpan(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	if !trace.SpanContextFromContext(ctx).IsRemote() {
+		a.missingTraceCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("endpoint", requestRoute(r))))
+	}
+	attrs := append(serverAttributes(r), baggageAttributes(ctx)...)
+	if variant, ok := requestVariant(r); ok {
+		ctx = withExperimentVariant(ctx, variant)
+		attrs = append(attrs, experimentVariantKey.String(variant))
+	}
+	if flags, ok := a.flags.attribute(); ok {
+		attrs = append(attrs, flags)
+	}
+	ctx, span := a.tracer.Start(ctx, name,
+		trace.WithTimestamp(spanClock.Now()),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, clockSpan{span}
+}
+
+// trailingSlash wraps mux to handle paths whose trailing slash is all that
+// keeps them from matching a route, per Config.TrailingSlash: "strip" serves
+// them as the route, so its pattern becomes the span's http.route, and
+// "redirect" sends the client there with 308 Permanent Redirect. Other paths,
+// and every path in "strict" mode, go to mux unchanged.
+func trailingSlash(mux *http.ServeMux, mode string) http.Handler {
+	if mode == "strict" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == "/" || !strings.HasSuffix(path, "/") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		canonical := r.Clone(r.Context())
+		canonical.URL.Path = strings.TrimRight(path, "/")
+		canonical.URL.RawPath = ""
+		if _, pattern := mux.Handler(canonical); pattern == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if mode == "redirect" {
+			http.Redirect(w, r, canonical.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+		mux.ServeHTTP(w, canonical)
+	})
+}
+
+// withTelemetry serves h in a server span named name, which h finds in the
+// request context, tagged with the method and endpoint. Once h returns, the
+// attributes enrichers and h collected are flushed onto the span and the
+// request is counted in requestCounter and its duration recorded in
+// requestDuration, both labelled with the status h actually wrote, and the
+// spans h started beneath the request span are recorded in spansPerRequest.
+// The endpoint, status and duration are handed to logAccess, so its access
+// log line matches them and is correlated with the span. A panic in h is
+// answered with a 500, as recoverPanics describes.
+func (a *App) withTelemetry(endpoint, name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := a.startServerSpan(r, name)
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("endpoint", endpoint),
+		)
+
+		start := time.Now()
+		ctx, spans := withSpanCounter(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+		recoverPanics(h)(rec, r.WithContext(ctx))
+		flushSpanAttributes(ctx, span)
+
+		status := rec.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		attrs := []attribute.KeyValue{
+			attribute.String("method", r.Method),
+			attribute.String("endpoint", endpoint),
+			attribute.String("status", strconv.Itoa(status)),
+		}
+		a.countRequest(ctx, attrs...)
+		duration := time.Since(start).Seconds()
+		a.recordDuration(ctx, duration, attrs...)
+		a.spansPerRequest.Record(ctx, spans.Load(), metric.WithAttributes(attribute.String("endpoint", endpoint)))
+		recordAccess(ctx, accessRecord{endpoint: endpoint, status: status, duration: duration, spanContext: span.SpanContext()})
+	}
+}
+
+// recoverPanics answers a panic in h with 500 Internal Server Error instead
+// of letting the server drop the connection, recording it as an error on the
+// span in the request context and logging the stack. When w is a
+// statusRecorder the request is recorded as a 500 even if h had already
+// written a status. http.ErrAbortHandler is re-raised, as it asks the
+// server to abort the response.
+func recoverPanics(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err := fmt.Errorf("panic: %v", v)
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err, trace.WithStackTrace(true))
+			span.SetStatus(codes.Error, err.Error())
+			slog.ErrorContext(r.Context(), "Handler panicked", "error", err, "stack", string(debug.Stack()))
+			if rec, ok := w.(*statusRecorder); ok {
+				rec.status = http.StatusInternalServerError
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		h(w, r)
+	}
+}
+
+// serverHandler wraps mux in the middlewares every request passes through:
+// drain tracking, the access log, panic recovery, header enrichment, the
+// method allowlists and trailing-slash handling. Panics in routes without
+// withTelemetry, or in the middlewares themselves, are still answered with
+// 500 and access logged.
+func (a *App) serverHandler(cfg *Config, mux *http.ServeMux) http.Handler {
+	h := a.allowMethods(cfg.RouteMethods, cfg.TrailingSlash, trailingSlash(mux, cfg.TrailingSlash))
+	h = enrich(h, headerEnricher(cfg.HeaderAttributes))
+	return drain.track(a.logAccess(recoverPanics(h.ServeHTTP)))
+}
+
+// statusRecorder remembers the status written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Status returns the status written, or 200 when h wrote nothing.
+func (w *statusRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Unwrap gives http.ResponseController access to w's ResponseWriter.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serverAttributes describes the matched route, with the method its pattern
+// is restricted to, and the listener that accepted r. The port distinguishes
+// traffic when several listeners serve the same handlers. With
+// Config.RecordGoroutines the goroutine count at request start is recorded
+// to correlate latency with load. With Config.CaptureTrafficSource the
+// Referer and Origin headers, when present, are recorded to show where
+// traffic comes from. TLS requests record the negotiated protocol version
+// and cipher suite for auditing clients. Requests with a body larger than
+// Config.ForceSampleRequestBytes are marked for forced sampling.
+func serverAttributes(r *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{routeKey.String(requestRoute(r))}
+	if method, _ := splitPattern(r.Pattern); method != "" {
+		attrs = append(attrs, attribute.String("http.route.matched_method", method))
+	}
+	if limit := appConfig.ForceSampleRequestBytes; limit > 0 && r.ContentLength > limit {
+		attrs = append(attrs,
+			attribute.Int64("http.request_content_length", r.ContentLength),
+			forceSampleKey.Bool(true),
+		)
+	}
+	if appConfig.RecordGoroutines {
+		attrs = append(attrs, attribute.Int("runtime.goroutines", runtime.NumGoroutine()))
+	}
+	if appConfig.CaptureTrafficSource {
+		if referer := r.Referer(); referer != "" {
+			attrs = append(attrs, attribute.String("http.request.header.referer", referer))
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			attrs = append(attrs, attribute.String("http.request.header.origin", origin))
+		}
+	}
+	if r.TLS != nil {
+		attrs = append(attrs,
+			attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(r.TLS.Version), "TLS ")),
+			attribute.String("tls.cipher", tls.CipherSuiteName(r.TLS.CipherSuite)),
+		)
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			if n, err := strconv.Atoi(port); err == nil {
+				attrs = append(attrs, attribute.Int("server.port", n))
+			}
+		}
+	}
+	return attrs
+}
+
+// requestRoute returns the route template that matched r, without the
+// method a pattern may start with, falling back to the request path when r
+// was not dispatched by a ServeMux.
+func requestRoute(r *http.Request) string {
+	if r.Pattern != "" {
+		_, route := splitPattern(r.Pattern)
+		return route
+	}
+	return r.URL.Path
+}
+
+// splitPattern splits a ServeMux pattern such as "POST /items/{id}" into
+// its method, empty when the pattern matches any method, and route.
+func splitPattern(pattern string) (method, route string) {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		return pattern[:i], strings.TrimLeft(pattern[i:], " \t")
+	}
+	return "", pattern
+}
@@ -0,0 +1,908 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestListenIPv6(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	probe, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	probe.Close()
+
+	tests := []struct {
+		name    string
+		network string
+	}{
+		{
+			name:    "dual-stack",
+			network: "tcp",
+		},
+		{
+			name:    "ipv6 only",
+			network: "tcp6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := listen(&Config{Port: "0", ListenNetwork: tt.network})
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/health", app.serveHealth)
+			srv := &http.Server{Handler: mux}
+			go srv.Serve(ln)
+			defer srv.Close()
+
+			_, port, _ := net.SplitHostPort(ln.Addr().String())
+			resp, err := http.Get("http://" + net.JoinHostPort("::1", port) + "/health")
+			if err != nil {
+				t.Fatalf("Request over IPv6 loopback failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(body) != "OK" {
+				t.Errorf("Expected 200 OK, got %d %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestServerPortAttribute(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", app.serveHealth)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	_, rawPort, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	wantPort, _ := strconv.Atoi(rawPort)
+
+	port, ok := spanAttribute(endedSpan(t, "health_check"), "server.port")
+	if !ok {
+		t.Fatal("Expected server.port attribute on health_check span")
+	}
+	if int(port.AsInt64()) != wantPort {
+		t.Errorf("Expected server.port %d, got %d", wantPort, port.AsInt64())
+	}
+}
+
+func TestMissingTraceCounter(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		wantCount   int64
+	}{
+		{
+			name:      "no traceparent",
+			wantCount: 1,
+		},
+		{
+			name:        "valid traceparent",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantCount:   0,
+		},
+		{
+			name:        "malformed traceparent",
+			traceparent: "00-not-a-trace-01",
+			wantCount:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			app.serveHealth(httptest.NewRecorder(), req)
+
+			rm := collectMetrics(t)
+			got := counterValue(t, rm, "http_requests_missing_trace_total", attribute.String("endpoint", "/health"))
+			if got != tt.wantCount {
+				t.Errorf("Expected http_requests_missing_trace_total %d, got %d", tt.wantCount, got)
+			}
+		})
+	}
+}
+
+func TestServerSpanContinuesRemoteTrace(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) { c.MaxWorkLatency = time.Millisecond })
+
+	srv := httptest.NewServer(http.HandlerFunc(app.serveWork))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/work", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	span := endedSpan(t, "do_work")
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the span to continue trace 4bf92f3577b34da6a3ce929d0e0e4736, got %s", got)
+	}
+	parent := span.Parent()
+	if !parent.IsRemote() || parent.TraceID() != span.SpanContext().TraceID() || parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected remote parent span 00f067aa0ba902b7 in the same trace, got %+v", parent)
+	}
+	if nested := endedSpan(t, "nested_operation"); nested.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("Expected nested_operation in trace %s, got %s", span.SpanContext().TraceID(), nested.SpanContext().TraceID())
+	}
+}
+
+func TestServerSpanTLSAttributes(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(app.serveHealth))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	span := endedSpan(t, "health_check")
+	wantVersion := strings.TrimPrefix(tls.VersionName(resp.TLS.Version), "TLS ")
+	if got, _ := spanAttribute(span, "tls.protocol.version"); got.AsString() != wantVersion {
+		t.Errorf("Expected tls.protocol.version %q, got %q", wantVersion, got.AsString())
+	}
+	wantCipher := tls.CipherSuiteName(resp.TLS.CipherSuite)
+	if got, _ := spanAttribute(span, "tls.cipher"); got.AsString() != wantCipher {
+		t.Errorf("Expected tls.cipher %q, got %q", wantCipher, got.AsString())
+	}
+}
+
+func TestServerSpanWithoutTLS(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if _, ok := spanAttribute(endedSpan(t, "health_check"), "tls.protocol.version"); ok {
+		t.Error("Expected no tls.protocol.version on a plaintext request")
+	}
+}
+
+func TestListenPortConflict(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to pre-bind a port: %v", err)
+	}
+	defer taken.Close()
+	_, port, _ := net.SplitHostPort(taken.Addr().String())
+
+	tests := []struct {
+		name    string
+		retries int
+	}{
+		{name: "no retries", retries: 0},
+		{name: "retries exhausted", retries: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := listen(&Config{
+				Port:               port,
+				ListenNetwork:      "tcp",
+				ListenRetries:      tt.retries,
+				ListenRetryBackoff: time.Millisecond,
+			})
+			if err == nil {
+				ln.Close()
+				t.Fatal("Expected a port conflict error")
+			}
+			if !errors.Is(err, syscall.EADDRINUSE) {
+				t.Errorf("Expected EADDRINUSE, got %v", err)
+			}
+			want := fmt.Sprintf("port %s is already in use after %d attempts", port, tt.retries+1)
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Expected error containing %q, got %q", want, err)
+			}
+		})
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	ln, err := listen(&Config{Port: "1", Addr: "127.0.0.1:0", ListenNetwork: "tcp"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if host != "127.0.0.1" {
+		t.Errorf("Expected the listener bound to 127.0.0.1, got %s", host)
+	}
+	if port == "1" {
+		t.Error("Expected ADDR to take precedence over PORT")
+	}
+}
+
+func TestServerSpanGoroutines(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled", enabled: true},
+		{name: "disabled", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) { c.RecordGoroutines = tt.enabled })
+
+			app.serveHealth(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			got, ok := spanAttribute(endedSpan(t, "health_check"), "runtime.goroutines")
+			if ok != tt.enabled {
+				t.Fatalf("Expected runtime.goroutines set=%v, got %v", tt.enabled, ok)
+			}
+			if ok && got.AsInt64() <= 0 {
+				t.Errorf("Expected a positive runtime.goroutines, got %d", got.AsInt64())
+			}
+		})
+	}
+}
+
+func TestServerSpanTrafficSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled", enabled: true},
+		{name: "disabled", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			withConfig(t, func(c *Config) { c.CaptureTrafficSource = tt.enabled })
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set("Referer", "https://example.com/pricing")
+			req.Header.Set("Origin", "https://example.com")
+			app.serveHealth(httptest.NewRecorder(), req)
+
+			span := endedSpan(t, "health_check")
+			for key, want := range map[string]string{
+				"http.request.header.referer": "https://example.com/pricing",
+				"http.request.header.origin":  "https://example.com",
+			} {
+				got, ok := spanAttribute(span, key)
+				if ok != tt.enabled {
+					t.Fatalf("Expected %s set=%v, got %v", key, tt.enabled, ok)
+				}
+				if ok && got.AsString() != want {
+					t.Errorf("Expected %s=%q, got %q", key, want, got.AsString())
+				}
+			}
+		})
+	}
+}
+
+func TestServerSpanMatchedRoute(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", app.serveHealth)
+	mux.HandleFunc("POST /items/{id}", app.serveHealth)
+	mux.HandleFunc("/any", app.serveHealth)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantRoute   string
+		wantMatched string
+	}{
+		{name: "POST route", method: http.MethodPost, target: "/items/42", wantRoute: "/items/{id}", wantMatched: "POST"},
+		{name: "GET route", method: http.MethodGet, target: "/items/42", wantRoute: "/items/{id}", wantMatched: "GET"},
+		{name: "HEAD served by GET", method: http.MethodHead, target: "/items/42", wantRoute: "/items/{id}", wantMatched: "GET"},
+		{name: "any method", method: http.MethodPut, target: "/any", wantRoute: "/any"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.target, nil))
+
+			span := endedSpan(t, "health_check")
+			if route, _ := spanAttribute(span, "http.route"); route.AsString() != tt.wantRoute {
+				t.Errorf("Expected http.route %q, got %q", tt.wantRoute, route.AsString())
+			}
+			matched, ok := spanAttribute(span, "http.route.matched_method")
+			if ok != (tt.wantMatched != "") || matched.AsString() != tt.wantMatched {
+				t.Errorf("Expected http.route.matched_method %q, got %q (set=%v)", tt.wantMatched, matched.AsString(), ok)
+			}
+		})
+	}
+}
+
+func TestWithTelemetry(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	var inSpan bool
+	h := app.withTelemetry("/teapot", "brew", func(w http.ResponseWriter, r *http.Request) {
+		inSpan = trace.SpanFromContext(r.Context()).SpanContext().IsValid()
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/teapot", nil))
+
+	if !inSpan {
+		t.Error("Expected the handler to run inside the server span")
+	}
+	span := endedSpan(t, "brew")
+	for key, want := range map[string]string{"endpoint": "/teapot", "http.request.method": http.MethodPost} {
+		if got, _ := spanAttribute(span, key); got.AsString() != want {
+			t.Errorf("Expected span %s=%q, got %q", key, want, got.AsString())
+		}
+	}
+
+	rm := collectMetrics(t)
+	if n := counterValue(t, rm, "http_requests_total",
+		attribute.String("endpoint", "/teapot"),
+		attribute.String("status", strconv.Itoa(http.StatusTeapot)),
+	); n != 1 {
+		t.Errorf("Expected 1 request counted with status %d, got %d", http.StatusTeapot, n)
+	}
+	if _, ok := findMetric(rm, "http_request_duration_seconds"); !ok {
+		t.Error("Expected the request duration to be recorded")
+	}
+}
+
+func TestWithTelemetryRecordsWrittenStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{
+			name:       "implicit 200",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("OK")) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "error",
+			handler:    func(w http.ResponseWriter, r *http.Request) { http.Error(w, "boom", http.StatusServiceUnavailable) },
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "first status wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			app.withTelemetry("/status", "status", tt.handler)(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected response status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			status := attribute.String("status", strconv.Itoa(tt.wantStatus))
+			rm := collectMetrics(t)
+			if n := counterValue(t, rm, "http_requests_total", status); n != 1 {
+				t.Errorf("Expected 1 request counted with %v, got %d", status, n)
+			}
+			m, ok := findMetric(rm, "http_request_duration_seconds")
+			if !ok {
+				t.Fatal("Expected http_request_duration_seconds to be collected")
+			}
+			points := m.Data.(metricdata.Histogram[float64]).DataPoints
+			if len(points) != 1 || !hasAttributes(points[0].Attributes, status) {
+				t.Errorf("Expected the duration labelled %v, got %+v", status, points)
+			}
+			if got, _ := spanAttribute(endedSpan(t, "status"), "http.status_code"); got.AsInt64() != int64(tt.wantStatus) {
+				t.Errorf("Expected span http.status_code %d, got %d", tt.wantStatus, got.AsInt64())
+			}
+		})
+	}
+}
+
+func TestWithTelemetryRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "before writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("nil map write")
+			},
+		},
+		{
+			name: "after writing the status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				panic("nil map write")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/boom", app.withTelemetry("/boom", "boom", tt.handler))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+			span := endedSpan(t, "boom")
+			if span.Status().Code != codes.Error || !strings.Contains(span.Status().Description, "nil map write") {
+				t.Errorf("Expected an error status naming the panic, got %+v", span.Status())
+			}
+			if events := span.Events(); len(events) != 1 || events[0].Name != "exception" {
+				t.Errorf("Expected the panic recorded as an exception event, got %+v", events)
+			}
+			if got, _ := spanAttribute(span, "http.status_code"); got.AsInt64() != http.StatusInternalServerError {
+				t.Errorf("Expected span http.status_code %d, got %d", http.StatusInternalServerError, got.AsInt64())
+			}
+			if n := counterValue(t, collectMetrics(t), "http_requests_total",
+				attribute.String("endpoint", "/boom"),
+				attribute.String("status", "500"),
+			); n != 1 {
+				t.Errorf("Expected 1 request counted with status 500, got %d", n)
+			}
+		})
+	}
+}
+
+func TestServerHandlerRecoversPanics(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	// Routes such as /ready and /debug/* are not wrapped in withTelemetry
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map write")
+	})
+	w := httptest.NewRecorder()
+	app.serverHandler(appConfig, mux).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/boom", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestWithTelemetryAccessLog(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	h := app.logAccess(app.withTelemetry("/teapot", "brew", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+
+	var line struct {
+		Msg      string  `json:"msg"`
+		Endpoint string  `json:"endpoint"`
+		Status   int     `json:"status"`
+		Duration float64 `json:"duration_seconds"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("Failed to decode access log %q: %v", logs.String(), err)
+	}
+	if line.Msg != "Request served" || line.Endpoint != "/teapot" || line.Status != http.StatusTeapot {
+		t.Errorf("Expected an access log for /teapot with status 418, got %+v", line)
+	}
+
+	m, ok := findMetric(collectMetrics(t), "http_request_duration_seconds")
+	if !ok {
+		t.Fatal("Expected http_request_duration_seconds to be collected")
+	}
+	var recorded float64
+	for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		if hasAttributes(point.Attributes, attribute.String("endpoint", "/teapot")) {
+			recorded = point.Sum
+		}
+	}
+	if line.Duration < 0.01 || math.Abs(line.Duration-recorded) > 1e-6 {
+		t.Errorf("Expected access log duration %v to match the recorded %v", line.Duration, recorded)
+	}
+}
+
+func TestAccessLogTraceCorrelation(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.AccessLogDisabledEndpoints = []string{"/health"}
+		c.MaxWorkLatency = time.Millisecond
+	})
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(newTraceHandler(slog.NewJSONHandler(&logs, nil))))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	errorRate.Store(0)
+	t.Cleanup(func() { errorRate.Store(appConfig.ErrorRate) })
+	app.logAccess(http.HandlerFunc(app.serveWork)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+	app.logAccess(http.HandlerFunc(app.serveHealth)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var lines []map[string]any
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("Failed to decode log line: %v", err)
+		}
+		if line["msg"] == "Request served" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 1 {
+		t.Fatalf("Expected one access log line with /health disabled, got %d", len(lines))
+	}
+
+	sc := endedSpan(t, "do_work").SpanContext()
+	for key, want := range map[string]any{
+		"method":   http.MethodGet,
+		"path":     "/work",
+		"status":   float64(http.StatusOK),
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	} {
+		if got := lines[0][key]; got != want {
+			t.Errorf("Expected access log %s=%v, got %v", key, want, got)
+		}
+	}
+	if _, ok := lines[0]["duration_seconds"].(float64); !ok {
+		t.Errorf("Expected a numeric duration_seconds, got %v", lines[0]["duration_seconds"])
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantRoute    string
+	}{
+		{name: "strip", mode: "strip", target: "/work/?type=io", wantStatus: http.StatusOK, wantRoute: "/work"},
+		{name: "redirect", mode: "redirect", target: "/work/?type=io", wantStatus: http.StatusPermanentRedirect, wantLocation: "/work?type=io"},
+		{name: "strict", mode: "strict", target: "/work/", wantStatus: http.StatusNotFound},
+		{name: "unknown route", mode: "strip", target: "/missing/", wantStatus: http.StatusNotFound},
+		{name: "canonical path", mode: "strip", target: "/work", wantStatus: http.StatusOK, wantRoute: "/work"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/work", app.withTelemetry("/work", "do_work", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("Work completed successfully"))
+			}))
+
+			w := httptest.NewRecorder()
+			trailingSlash(mux, tt.mode).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Expected Location %q, got %q", tt.wantLocation, got)
+			}
+			if tt.wantRoute == "" {
+				if spans := spanRecorder.Ended(); len(spans) != 0 {
+					t.Errorf("Expected no request span, got %d", len(spans))
+				}
+				return
+			}
+			if route, _ := spanAttribute(endedSpan(t, "do_work"), "http.route"); route.AsString() != tt.wantRoute {
+				t.Errorf("Expected http.route %q, got %q", tt.wantRoute, route.AsString())
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate and key for 127.0.0.1 to
+// dir and returns their paths.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestServeTLSMinVersion(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+
+	// Go servers refuse TLS 1.0 and 1.1 by default, so only a 1.2 client
+	// against a 1.3 minimum shows TLS_MIN_VERSION taking effect
+	tests := []struct {
+		name          string
+		minVersion    string
+		clientVersion uint16
+		wantMin       uint16
+		wantErr       bool
+	}{
+		{name: "TLS 1.2 client accepted", minVersion: "1.2", clientVersion: tls.VersionTLS12, wantMin: tls.VersionTLS12},
+		{name: "TLS 1.2 client rejected by 1.3", minVersion: "1.3", clientVersion: tls.VersionTLS12, wantMin: tls.VersionTLS13, wantErr: true},
+		{name: "TLS 1.3 client accepted", minVersion: "1.3", clientVersion: tls.VersionTLS13, wantMin: tls.VersionTLS13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: tt.minVersion}
+			if got := cfg.tlsConfig().MinVersion; got != tt.wantMin {
+				t.Errorf("Expected TLS min version %#x, got %#x", tt.wantMin, got)
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			srv := &http.Server{Handler: http.NotFoundHandler(), ErrorLog: log.New(io.Discard, "", 0)}
+			go serve(cfg, srv, ln)
+			defer srv.Close()
+
+			conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+				MinVersion:         tt.clientVersion,
+				MaxVersion:         tt.clientVersion,
+				InsecureSkipVerify: true,
+			})
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected handshake error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestListenInvalidCertificate(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	_, otherKeyFile := writeTestCert(t, t.TempDir())
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{name: "plaintext"},
+		{name: "valid pair", certFile: certFile, keyFile: keyFile},
+		{name: "mismatched key", certFile: certFile, keyFile: otherKeyFile, wantErr: true},
+		{name: "missing certificate", certFile: filepath.Join(t.TempDir(), "cert.pem"), keyFile: keyFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := listen(&Config{Port: "0", ListenNetwork: "tcp", TLSCertFile: tt.certFile, TLSKeyFile: tt.keyFile})
+			if err == nil {
+				ln.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected listen error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAllowMethods(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		origin        bool
+		trailingSlash string
+		wantStatus    int
+		wantAllow     string
+		wantCORS      bool
+	}{
+		{name: "options", method: http.MethodOptions, path: "/work", wantStatus: http.StatusNoContent, wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{name: "cors preflight", method: http.MethodOptions, path: "/work", origin: true, wantStatus: http.StatusNoContent, wantAllow: "GET, HEAD, POST, OPTIONS", wantCORS: true},
+		{name: "allowed method", method: http.MethodPost, path: "/work", wantStatus: http.StatusOK},
+		{name: "head on a get route", method: http.MethodHead, path: "/work", wantStatus: http.StatusOK},
+		{name: "disallowed method", method: http.MethodDelete, path: "/work", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{name: "unlisted route", method: http.MethodOptions, path: "/ready", wantStatus: http.StatusOK},
+		{name: "trailing slash stripped", method: http.MethodOptions, path: "/work/", trailingSlash: "strip", wantStatus: http.StatusNoContent, wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{name: "trailing slash strict", method: http.MethodOptions, path: "/work/", trailingSlash: "strict", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := setupTestTelemetry()
+			if err != nil {
+				t.Fatalf("Failed to setup test telemetry: %v", err)
+			}
+			routes, err := parseRouteMethods("/work=get|post")
+			if err != nil {
+				t.Fatalf("Failed to parse route methods: %v", err)
+			}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin {
+				req.Header.Set("Origin", "https://example.com")
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			app.allowMethods(routes, tt.trailingSlash, next).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.wantAllow, got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); (got != "") != tt.wantCORS {
+				t.Errorf("Expected Access-Control-Allow-Methods set=%v, got %q", tt.wantCORS, got)
+			}
+
+			rm := collectMetrics(t)
+			var want int64
+			if tt.wantStatus == http.StatusNoContent {
+				want = 1
+			}
+			if got := counterValue(t, rm, "http_preflight_requests_total",
+				attribute.String("endpoint", "/work"),
+				attribute.Bool("cors", tt.wantCORS),
+			); got != want {
+				t.Errorf("Expected http_preflight_requests_total %d, got %d", want, got)
+			}
+
+			// Answers from the allowlist are counted like any other request
+			if tt.wantAllow == "" {
+				return
+			}
+			if got := counterValue(t, rm, "http_requests_total",
+				attribute.String("endpoint", "/work"),
+				attribute.String("status", strconv.Itoa(tt.wantStatus)),
+			); got != 1 {
+				t.Errorf("Expected the %d answer in http_requests_total, got %d", tt.wantStatus, got)
+			}
+			spanName := "options"
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				spanName = "method_not_allowed"
+			}
+			if got, _ := spanAttribute(endedSpan(t, spanName), "http.status_code"); got.AsInt64() != int64(tt.wantStatus) {
+				t.Errorf("Expected a %s span with http.status_code %d, got %d", spanName, tt.wantStatus, got.AsInt64())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// instrumentSnapshot is the JSON form of one instrument's current values as
+// served by /metrics.
+type instrumentSnapshot struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Points []pointSnapshot `json:"points"`
+}
+
+// pointSnapshot is one attribute set's value. Sums and gauges fill Value;
+// histograms fill Count and Sum.
+type pointSnapshot struct {
+	Attributes map[string]string `json:"attributes"`
+	Value      *float64          `json:"value,omitempty"`
+	Count      *uint64           `json:"count,omitempty"`
+	Sum        *float64          `json:"sum,omitempty"`
+}
+
+// snapshotMetrics collects the current value of every instrument from reader.
+func snapshotMetrics(ctx context.Context, reader *sdkmetric.ManualReader) ([]instrumentSnapshot, error) {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		return nil, err
+	}
+
+	instruments := []instrumentSnapshot{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			snap := instrumentSnapshot{Name: m.Name, Points: []pointSnapshot{}}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				snap.Type = "sum"
+				snap.Points = appendValuePoints(snap.Points, data.DataPoints)
+			case metricdata.Sum[float64]:
+				snap.Type = "sum"
+				snap.Points = appendValuePoints(snap.Points, data.DataPoints)
+			case metricdata.Gauge[int64]:
+				snap.Type = "gauge"
+				snap.Points = appendValuePoints(snap.Points, data.DataPoints)
+			case metricdata.Gauge[float64]:
+				snap.Type = "gauge"
+				snap.Points = appendValuePoints(snap.Points, data.DataPoints)
+			case metricdata.Histogram[int64]:
+				snap.Type = "histogram"
+				snap.Points = appendHistogramPoints(snap.Points, data.DataPoints)
+			case metricdata.Histogram[float64]:
+				snap.Type = "histogram"
+				snap.Points = appendHistogramPoints(snap.Points, data.DataPoints)
+			default:
+				continue
+			}
+			instruments = append(instruments, snap)
+		}
+	}
+	return instruments, nil
+}
+
+func appendValuePoints[N int64 | float64](points []pointSnapshot, dps []metricdata.DataPoint[N]) []pointSnapshot {
+	for _, dp := range dps {
+		value := float64(dp.Value)
+		points = append(points, pointSnapshot{
+			Attributes: attributeMap(dp.Attributes),
+			Value:      &value,
+		})
+	}
+	return points
+}
+
+func appendHistogramPoints[N int64 | float64](points []pointSnapshot, dps []metricdata.HistogramDataPoint[N]) []pointSnapshot {
+	for _, dp := range dps {
+		count := dp.Count
+		sum := float64(dp.Sum)
+		points = append(points, pointSnapshot{
+			Attributes: attributeMap(dp.Attributes),
+			Count:      &count,
+			Sum:        &sum,
+		})
+	}
+	return points
+}
+
+func attributeMap(set attribute.Set) map[string]string {
+	m := make(map[string]string, set.Len())
+	for _, kv := range set.ToSlice() {
+		m[string(kv.Key)] = kv.Value.Emit()
+	}
+	return m
+}
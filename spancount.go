@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanCounterKey struct{}
+
+// withSpanCounter returns a context in which spans started through a
+// countingTracer are counted, along with the count.
+func withSpanCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	n := &atomic.Int64{}
+	return context.WithValue(ctx, spanCounterKey{}, n), n
+}
+
+// countingTracer counts the spans it starts in the counter held by their
+// context, if any, so a request can report how many spans it fanned out to.
+type countingTracer struct {
+	trace.Tracer
+}
+
+func (t countingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if n, ok := ctx.Value(spanCounterKey{}).(*atomic.Int64); ok {
+		n.Add(1)
+	}
+	return t.Tracer.Start(ctx, name, opts...)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSpansPerRequest(t *testing.T) {
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+	withConfig(t, func(c *Config) {
+		c.MaxWorkLatency = time.Millisecond
+		c.DownstreamURL = ""
+	})
+
+	const requests = 2
+	for i := 0; i < requests; i++ {
+		app.serveWork(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+	}
+
+	m, ok := findMetric(collectMetrics(t), "spans_per_request")
+	if !ok {
+		t.Fatal("Expected spans_per_request to be collected")
+	}
+	points := m.Data.(metricdata.Histogram[int64]).DataPoints
+	if len(points) != 1 || !hasAttributes(points[0].Attributes, attribute.String("endpoint", "/work")) {
+		t.Fatalf("Expected one /work series, got %+v", points)
+	}
+	if points[0].Count != requests || points[0].Sum != requests {
+		t.Errorf("Expected 1 nested span for each of %d requests, got count %d sum %d", requests, points[0].Count, points[0].Sum)
+	}
+	if max, _ := points[0].Max.Value(); max != 1 {
+		t.Errorf("Expected at most 1 nested span per request, got %d", max)
+	}
+}
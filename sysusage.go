@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// systemUsageInterval is how long a systemUsage reading is reused, so the
+// gauges and /metrics report the same values and the CPU share is measured
+// over a meaningful window.
+const systemUsageInterval = time.Second
+
+// systemUsage reads the process's CPU and memory use for the
+// system.cpu.usage and system.memory.usage gauges and /metrics.
+type systemUsage struct {
+	mu     sync.Mutex
+	at     time.Time
+	cpu    time.Duration
+	cpuPct float64
+	memory float64
+}
+
+func newSystemUsage() *systemUsage {
+	return &systemUsage{at: time.Now(), cpu: processCPUTime()}
+}
+
+// read returns the share of the machine's CPU, in percent, the process used
+// since the previous reading and the bytes of memory it holds from the OS.
+// Readings less than systemUsageInterval apart return the earlier values.
+func (u *systemUsage) read() (cpuPct, memory float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if u.memory != 0 && now.Sub(u.at) < systemUsageInterval {
+		return u.cpuPct, u.memory
+	}
+	cpu := processCPUTime()
+	if wall := now.Sub(u.at); wall > 0 {
+		u.cpuPct = 100 * float64(cpu-u.cpu) / float64(wall) / float64(runtime.NumCPU())
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	u.at, u.cpu, u.memory = now, cpu, float64(ms.Sys)
+	return u.cpuPct, u.memory
+}
+
+// registerSystemUsageGauges reports u through the system.cpu.usage and
+// system.memory.usage gauges.
+func registerSystemUsageGauges(m metric.Meter, u *systemUsage) error {
+	cpu, err := m.Float64ObservableGauge(
+		"system.cpu.usage",
+		metric.WithDescription("Share of the machine's CPU used by the process since the previous reading"),
+		metric.WithUnit("%"),
+	)
+	if err != nil {
+		return err
+	}
+	memory, err := m.Float64ObservableGauge(
+		"system.memory.usage",
+		metric.WithDescription("Memory the process holds from the operating system"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		cpuPct, bytes := u.read()
+		o.ObserveFloat64(cpu, cpuPct)
+		o.ObserveFloat64(memory, bytes)
+		return nil
+	}, cpu, memory)
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// processCPUTime reports no CPU time where getrusage is unavailable, so
+// system.cpu.usage reads 0 there.
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSystemUsageGauges(t *testing.T) {
+	orig := usage
+	usage = newSystemUsage()
+	t.Cleanup(func() { usage = orig })
+	app, err := setupTestTelemetry()
+	if err != nil {
+		t.Fatalf("Failed to setup test telemetry: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	app.serveMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var got struct {
+		CPUUsage    float64 `json:"cpu_usage"`
+		MemoryUsage float64 `json:"memory_usage"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.CPUUsage < 0 || got.MemoryUsage <= 0 {
+		t.Errorf("Expected non-negative CPU and positive memory usage, got %+v", got)
+	}
+
+	rm := collectMetrics(t)
+	for name, want := range map[string]float64{
+		"system.cpu.usage":    got.CPUUsage,
+		"system.memory.usage": got.MemoryUsage,
+	} {
+		m, ok := findMetric(rm, name)
+		if !ok {
+			t.Fatalf("Expected %s to be collected", name)
+		}
+		if v := m.Data.(metricdata.Gauge[float64]).DataPoints[0].Value; v != want {
+			t.Errorf("Expected %s to match /metrics' %v, got %v", name, want, v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracingStats counts span outcomes since startup for /debug/tracing. The
+// span processor sees only recorded spans, so the sampler wrapper returned
+// by wrap counts the spans the sampler drops before any processor runs.
+type tracingStats struct {
+	since   time.Time
+	sampler atomic.Value // string description of the wrapped sampler
+
+	started atomic.Int64
+	sampled atomic.Int64
+	dropped atomic.Int64
+}
+
+func newTracingStats() *tracingStats {
+	s := &tracingStats{since: time.Now()}
+	s.sampler.Store("")
+	return s
+}
+
+// wrap returns sampler counting every span start and each dropped span in s.
+func (s *tracingStats) wrap(sampler sdktrace.Sampler) sdktrace.Sampler {
+	s.sampler.Store(sampler.Description())
+	return statsSampler{next: sampler, stats: s}
+}
+
+type statsSampler struct {
+	next  sdktrace.Sampler
+	stats *tracingStats
+}
+
+func (s statsSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.next.ShouldSample(p)
+	s.stats.started.Add(1)
+	if res.Decision == sdktrace.Drop {
+		s.stats.dropped.Add(1)
+	}
+	return res
+}
+
+func (s statsSampler) Description() string { return s.next.Description() }
+
+// OnStart counts the spans that will be exported.
+func (s *tracingStats) OnStart(_ context.Context, span sdktrace.ReadWriteSpan) {
+	if span.SpanContext().IsSampled() {
+		s.sampled.Add(1)
+	}
+}
+
+func (s *tracingStats) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (s *tracingStats) Shutdown(context.Context) error   { return nil }
+func (s *tracingStats) ForceFlush(context.Context) error { return nil }
+
+// registerSampleRateGauge reports the share of started spans s has seen
+// sampled through the trace_effective_sample_rate gauge, so the sampling
+// actually applied can be checked against the configuration. Nothing is
+// observed before the first span starts.
+func registerSampleRateGauge(m metric.Meter, s *tracingStats) error {
+	rate, err := m.Float64ObservableGauge(
+		"trace_effective_sample_rate",
+		metric.WithDescription("Share of spans started since startup that were sampled"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if started := s.started.Load(); started > 0 {
+			o.ObserveFloat64(rate, float64(s.sampled.Load())/float64(started))
+		}
+		return nil
+	}, rate)
+	return err
+}
+
+// debugTracingHandler serves the tracing statistics as JSON.
+func debugTracingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Sampler      string    `json:"sampler"`
+		Since        time.Time `json:"since"`
+		SpansStarted int64     `json:"spans_started"`
+		SpansSampled int64     `json:"spans_sampled"`
+		SpansDropped int64     `json:"spans_dropped"`
+	}{
+		Sampler:      stats.sampler.Load().(string),
+		Since:        stats.since,
+		SpansStarted: stats.started.Load(),
+		SpansSampled: stats.sampled.Load(),
+		SpansDropped: stats.dropped.Load(),
+	})
+}
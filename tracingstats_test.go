@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDebugTracingHandler(t *testing.T) {
+	orig := stats
+	stats = newTracingStats()
+	t.Cleanup(func() { stats = orig })
+
+	sampler := newRouteSampler(map[string]float64{"/work": 1, "/health": 0}, sdktrace.AlwaysSample())
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(stats.wrap(sampler)),
+		sdktrace.WithSpanProcessor(stats),
+	)
+	defer provider.Shutdown(context.Background())
+	tr := provider.Tracer("test")
+
+	for _, route := range []string{"/work", "/work", "/work", "/health", "/health"} {
+		_, span := tr.Start(context.Background(), "request", trace.WithAttributes(routeKey.String(route)))
+		span.End()
+	}
+
+	w := httptest.NewRecorder()
+	debugTracingHandler(w, httptest.NewRequest(http.MethodGet, "/debug/tracing", nil))
+
+	var got struct {
+		Sampler      string `json:"sampler"`
+		SpansStarted int64  `json:"spans_started"`
+		SpansSampled int64  `json:"spans_sampled"`
+		SpansDropped int64  `json:"spans_dropped"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if got.Sampler != sampler.Description() {
+		t.Errorf("Expected sampler %q, got %q", sampler.Description(), got.Sampler)
+	}
+	tests := []struct {
+		name     string
+		got      int64
+		expected int64
+	}{
+		{name: "started", got: got.SpansStarted, expected: 5},
+		{name: "sampled", got: got.SpansSampled, expected: 3},
+		{name: "dropped", got: got.SpansDropped, expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("Expected %d spans %s, got %d", tt.expected, tt.name, tt.got)
+			}
+		})
+	}
+}
+
+func TestEffectiveSampleRateGauge(t *testing.T) {
+	orig := stats
+	stats = newTracingStats()
+	t.Cleanup(func() { stats = orig })
+
+	sampler, err := newSampler(&Config{TraceSampler: "parentbased_always_on", SampleRatio: 0.5})
+	if err != nil {
+		t.Fatalf("Failed to create sampler: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(stats.wrap(sampler)),
+		sdktrace.WithSpanProcessor(stats),
+	)
+	defer provider.Shutdown(context.Background())
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer meterProvider.Shutdown(context.Background())
+	if err := registerSampleRateGauge(meterProvider.Meter("test"), stats); err != nil {
+		t.Fatalf("Failed to register gauge: %v", err)
+	}
+
+	tr := provider.Tracer("test")
+	for i := 0; i < 10000; i++ {
+		_, span := tr.Start(context.Background(), "request")
+		span.End()
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	m, ok := findMetric(rm, "trace_effective_sample_rate")
+	if !ok {
+		t.Fatal("Expected trace_effective_sample_rate to be collected")
+	}
+	if got := m.Data.(metricdata.Gauge[float64]).DataPoints[0].Value; math.Abs(got-0.5) > 0.03 {
+		t.Errorf("Expected an effective sample rate near 0.5, got %v", got)
+	}
+}